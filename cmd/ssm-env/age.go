@@ -0,0 +1,38 @@
+package main
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// reportParameterAge logs the oldest and the newest of the parameters by
+// their last modification, to spot forgotten config and config that changes
+// suspiciously often. Parameters without a modification date, like those of
+// Vault and Secrets Manager, are left out.
+func reportParameterAge(parameters []resolvedParameter, now time.Time) {
+	var oldest, newest *resolvedParameter
+	for i, p := range parameters {
+		if p.LastModifiedDate == nil {
+			continue
+		}
+		if oldest == nil || p.LastModifiedDate.Before(*oldest.LastModifiedDate) {
+			oldest = &parameters[i]
+		}
+		if newest == nil || p.LastModifiedDate.After(*newest.LastModifiedDate) {
+			newest = &parameters[i]
+		}
+	}
+	if oldest == nil {
+		log.Info("no parameter has a modification date, not reporting parameter age")
+		return
+	}
+
+	log.WithField("oldest", *oldest.Name).
+		WithField("oldest_age", now.Sub(*oldest.LastModifiedDate).Round(time.Second).String()).
+		WithField("oldest_modified", oldest.LastModifiedDate.Format(time.RFC3339)).
+		WithField("newest", *newest.Name).
+		WithField("newest_age", now.Sub(*newest.LastModifiedDate).Round(time.Second).String()).
+		WithField("newest_modified", newest.LastModifiedDate.Format(time.RFC3339)).
+		Info("parameter age")
+}
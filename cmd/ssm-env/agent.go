@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// agentSocketEnvVar tells the child where to reach the agent
+const agentSocketEnvVar = "SSM_ENV_AGENT_SOCKET"
+
+// agent serves the resolved parameters over a unix socket instead of
+// injecting them into the environment of the child, refreshing them
+// periodically so rotated values are picked up without a restart.
+//
+// The protocol is line based: the client sends "GET NAME\n" and the agent
+// answers with "OK <value>\n", where the value is JSON string encoded, or
+// with "ERR <message>\n".
+type agent struct {
+	listener net.Listener
+	path     string
+	done     chan struct{}
+
+	mu     sync.RWMutex
+	values map[string]string
+}
+
+func startAgent(c *cli.Context, socketPath string) (*agent, error) {
+	values, err := fetchAgentValues(c)
+	if err != nil {
+		return nil, err
+	}
+
+	// clean up a socket left over from a previous run
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	listener, err := listenUnix(socketPath)
+	if err != nil {
+		return nil, err
+	}
+	// only the user running ssm-env (and thus the child) may connect
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	if err := os.Setenv(agentSocketEnvVar, socketPath); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+
+	a := &agent{
+		listener: listener,
+		path:     socketPath,
+		done:     make(chan struct{}),
+		values:   values,
+	}
+	go a.serve()
+	if interval := c.GlobalDuration("agent-refresh"); interval > 0 {
+		go a.refresh(c, interval)
+	}
+	log.WithField("socket", socketPath).WithField("parameters", len(values)).Info("agent listening")
+	return a, nil
+}
+
+// fetchAgentValues resolves the parameters into a name->value map, expanding
+// references against the other parameters and the environment of ssm-env.
+func fetchAgentValues(c *cli.Context) (map[string]string, error) {
+	parameters, err := fetchParameters(context.TODO(), c)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	for _, p := range parameters {
+		values[p.EnvName] = *p.Value
+	}
+
+	if !c.GlobalBool("no-expand") {
+		return expandAllowed(c, values, os.Getenv)
+	}
+	return values, nil
+}
+
+func (a *agent) refresh(c *cli.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+			values, err := fetchAgentValues(c)
+			if err != nil {
+				log.WithError(err).Warn("agent refresh failed, keeping previous values")
+				continue
+			}
+			a.mu.Lock()
+			a.values = values
+			a.mu.Unlock()
+			log.WithField("parameters", len(values)).Debug("agent refreshed parameters")
+		}
+	}
+}
+
+func (a *agent) serve() {
+	for {
+		conn, err := a.listener.Accept()
+		if err != nil {
+			select {
+			case <-a.done:
+			default:
+				log.WithError(err).Error("agent stopped accepting connections")
+			}
+			return
+		}
+		go a.handle(conn)
+	}
+}
+
+func (a *agent) handle(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		_, _ = conn.Write([]byte(a.respond(scanner.Text()) + "\n"))
+	}
+}
+
+func (a *agent) respond(request string) string {
+	fields := strings.Fields(request)
+	if len(fields) != 2 || fields[0] != "GET" {
+		return "ERR expected GET NAME"
+	}
+
+	a.mu.RLock()
+	value, ok := a.values[fields[1]]
+	a.mu.RUnlock()
+	if !ok {
+		return "ERR not found"
+	}
+	encoded, _ := json.Marshal(value)
+	return "OK " + string(encoded)
+}
+
+func (a *agent) Close() {
+	close(a.done)
+	_ = a.listener.Close()
+	_ = os.Remove(a.path)
+}
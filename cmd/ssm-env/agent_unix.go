@@ -0,0 +1,17 @@
+//go:build !windows
+
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenUnix creates the unix socket at path with a umask that keeps other
+// users out from the start, instead of only after a chmod. The umask is
+// process wide, nothing else creates files while the agent starts.
+func listenUnix(path string) (net.Listener, error) {
+	umask := syscall.Umask(0077)
+	defer syscall.Umask(umask)
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,30 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestAgentSocketIsPrivateFromTheStart(t *testing.T) {
+	// the most permissive umask, so only listenUnix restricts the socket
+	defer syscall.Umask(syscall.Umask(0))
+
+	path := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := listenUnix(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		t.Errorf("socket created with mode %o, want no access for group and others", perm)
+	}
+}
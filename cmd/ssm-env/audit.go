@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// severities of audit issues, from the most to the least severe
+const (
+	severityHigh   = "high"
+	severityMedium = "medium"
+	severityLow    = "low"
+)
+
+var severityOrder = map[string]int{severityHigh: 0, severityMedium: 1, severityLow: 2}
+
+// placeholderValues are values left behind when a parameter was created
+// before its real value was known, compared case insensitively
+var placeholderValues = map[string]bool{
+	"changeme": true, "change-me": true, "change_me": true, "todo": true, "tbd": true,
+	"fixme": true, "placeholder": true, "xxx": true, "dummy": true, "replaceme": true,
+}
+
+// placeholderToken matches a value that is a single bracketed word like
+// <password> or <API KEY>, unlike XML, HTML or PEM-like values
+var placeholderToken = regexp.MustCompile(`^<[A-Za-z0-9_ -]+>$`)
+
+// auditIssue is a single finding of the audit. It never holds a value.
+type auditIssue struct {
+	Severity  string `json:"severity"`
+	Check     string `json:"check"`
+	Parameter string `json:"parameter"`
+	Message   string `json:"message"`
+}
+
+func auditCommand() cli.Command {
+	return cli.Command{
+		Name:      "audit",
+		Usage:     "Check the parameters for config hygiene issues and print a report, failing on high severity issues",
+		UsageText: "ssm-env -p prefix audit [--stale-after duration] [--max-value-size bytes] [--json]",
+		Flags: []cli.Flag{
+			cli.DurationFlag{
+				Name:  "stale-after",
+				Value: 365 * 24 * time.Hour,
+				Usage: "Report parameters not modified for longer than this as stale, 0 to disable",
+			},
+			cli.IntFlag{
+				Name:  "max-value-size",
+				Value: 4096,
+				Usage: "Report values larger than this many bytes as oversized, 0 to disable",
+			},
+			cli.BoolFlag{
+				Name:  "json",
+				Usage: "Print the report as JSON",
+			},
+		},
+		Action: auditAction,
+	}
+}
+
+func auditAction(c *cli.Context) error {
+	if err := configureLogging(c); err != nil {
+		return cli.NewExitError(errorPrefix(err), ValidateArgsError)
+	}
+	// stdout is reserved for the report
+	if !c.GlobalBool("silent") {
+		log.SetOutput(os.Stderr)
+	}
+
+	if err := validateAuditArgs(c); err != nil {
+		return cli.NewExitError(errorPrefix(err), ValidateArgsError)
+	}
+
+	parameters, err := fetchParameters(context.TODO(), c)
+	if err != nil {
+		return cli.NewExitError(errorPrefix(err), GetParametersError)
+	}
+
+	issues := auditParameters(c, parameters, time.Now())
+	report := formatAuditReport(issues)
+	if c.Bool("json") {
+		if report, err = formatAuditJSON(issues); err != nil {
+			return cli.NewExitError(errorPrefix(err), WriteOutputError)
+		}
+	}
+	if _, err := os.Stdout.WriteString(report); err != nil {
+		return cli.NewExitError(errorPrefix(err), WriteOutputError)
+	}
+
+	for _, issue := range issues {
+		if issue.Severity == severityHigh {
+			return cli.NewExitError(errorPrefix(errors.New("audit found high severity issues")), AuditError)
+		}
+	}
+	return nil
+}
+
+func validateAuditArgs(c *cli.Context) error {
+	if len(prefixes(c)) == 0 && len(c.GlobalStringSlice("param")) == 0 && len(c.GlobalStringSlice("secrets-prefix")) == 0 && c.GlobalString("canary-prefix") == "" {
+		return errors.New("prefix, param or secrets-prefix is required")
+	}
+	if c.GlobalInt("concurrency") < 1 {
+		return errors.New("concurrency must be at least 1")
+	}
+	if _, err := parseTagFilters(c.GlobalStringSlice("tag-filter")); err != nil {
+		return err
+	}
+	if err := validatePrefixLabels(c); err != nil {
+		return err
+	}
+	if c.Duration("stale-after") < 0 {
+		return errors.New("stale-after must not be negative")
+	}
+	if c.Int("max-value-size") < 0 {
+		return errors.New("max-value-size must not be negative")
+	}
+	return nil
+}
+
+// auditParameters runs all checks over the parameters and returns the issues
+// sorted by severity and parameter.
+func auditParameters(c *cli.Context, parameters []resolvedParameter, now time.Time) []auditIssue {
+	var issues []auditIssue
+	add := func(severity, check, parameter, format string, args ...interface{}) {
+		issues = append(issues, auditIssue{Severity: severity, Check: check, Parameter: parameter, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, d := range findPlaintextDuplicates(parameters) {
+		add(severityHigh, "plaintext-secret", d.Plaintext, "holds the value of the SecureString %s in plaintext", d.Secure)
+	}
+
+	staleAfter := c.Duration("stale-after")
+	maxSize := c.Int("max-value-size")
+	longEnvName := c.GlobalBool("long-env-name")
+	for _, p := range parameters {
+		value := strings.TrimSpace(*p.Value)
+		switch {
+		case value == "":
+			add(severityMedium, "empty-value", *p.Name, "value is empty")
+		case placeholderValues[strings.ToLower(value)] || placeholderToken.MatchString(value):
+			add(severityHigh, "placeholder-value", *p.Name, "value looks like a placeholder")
+		}
+
+		if maxSize > 0 && len(*p.Value) > maxSize {
+			add(severityMedium, "oversized-value", *p.Name, "value is %d bytes, more than %d", len(*p.Value), maxSize)
+		}
+
+		if staleAfter > 0 && p.LastModifiedDate != nil && now.Sub(*p.LastModifiedDate) > staleAfter {
+			add(severityLow, "stale", *p.Name, "not modified since %s", p.LastModifiedDate.Format("2006-01-02"))
+		}
+
+		// names derived from the path before --name-transform and --upcase
+		if p.Source == sourceSSM {
+			prefix := p.Prefix
+			if prefix == "" {
+				prefix = "/"
+			}
+			if name := envName(*p.Name, prefix, longEnvName); !shellIdentifier.MatchString(name) {
+				add(severityMedium, "invalid-name", *p.Name, "%q is not a valid shell identifier, it is exported as %s", name, p.EnvName)
+			}
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Severity != issues[j].Severity {
+			return severityOrder[issues[i].Severity] < severityOrder[issues[j].Severity]
+		}
+		return issues[i].Parameter < issues[j].Parameter
+	})
+	return issues
+}
+
+func formatAuditReport(issues []auditIssue) string {
+	var sb strings.Builder
+	if len(issues) == 0 {
+		sb.WriteString("no issues found\n")
+		return sb.String()
+	}
+	w := tabwriter.NewWriter(&sb, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SEVERITY\tCHECK\tPARAMETER\tMESSAGE")
+	for _, issue := range issues {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", issue.Severity, issue.Check, issue.Parameter, issue.Message)
+	}
+	w.Flush()
+
+	counts := map[string]int{}
+	for _, issue := range issues {
+		counts[issue.Severity]++
+	}
+	fmt.Fprintf(&sb, "\n%d issues: %d high, %d medium, %d low\n", len(issues), counts[severityHigh], counts[severityMedium], counts[severityLow])
+	return sb.String()
+}
+
+func formatAuditJSON(issues []auditIssue) (string, error) {
+	if issues == nil {
+		issues = []auditIssue{}
+	}
+	out, err := json.MarshalIndent(map[string]interface{}{"issues": issues}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out) + "\n", nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+func TestAuditPlaceholderValues(t *testing.T) {
+	tests := map[string]bool{
+		"changeme":                   true,
+		" TODO ":                     true,
+		"<password>":                 true,
+		"<API KEY>":                  true,
+		"<db_host-name>":             true,
+		"s3cr3t":                     false,
+		"<>":                         false,
+		"<root><child/></root>":      false,
+		"<b>bold</b>":                false,
+		"<a href=\"https://x\">":     false,
+		"<!-- comment -->":           false,
+		"<https://example.com/hook>": false,
+		"<-----BEGIN KEY----->\nMIIB\n<-----END KEY----->": false,
+	}
+	c := newTestCommandContext(t, newTestContext(t), auditCommand())
+	for value, placeholder := range tests {
+		parameters := []resolvedParameter{{
+			Parameter: types.Parameter{Name: aws.String("/app/VALUE"), Type: types.ParameterTypeString, Value: aws.String(value)},
+			Source:    sourceSSM,
+			Prefix:    "/app/",
+			EnvName:   "VALUE",
+		}}
+		found := false
+		for _, issue := range auditParameters(c, parameters, time.Now()) {
+			if issue.Check == "placeholder-value" {
+				found = true
+			}
+		}
+		if found != placeholder {
+			t.Errorf("%q reported as placeholder %t, want %t", value, found, placeholder)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/urfave/cli"
+)
+
+// launchSpec is the document stored in the --bootstrap parameter
+type launchSpec struct {
+	Prefixes     []string `json:"prefixes"`
+	CommonPrefix string   `json:"commonPrefix"`
+	LongEnvName  *bool    `json:"longEnvName"`
+	NoExpand     *bool    `json:"noExpand"`
+	Procfiles    []string `json:"procfiles"`
+	Command      []string `json:"command"`
+}
+
+// fetchLaunchSpec reads and parses the launch spec stored in a parameter.
+func fetchLaunchSpec(ctx context.Context, c *cli.Context, name string) (*launchSpec, error) {
+	svc, err := newSSMClient(ctx, c)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load SDK config, %v", err)
+	}
+	withDecryption := !c.GlobalBool("no-decryption")
+	result, err := svc.GetParameter(ctx, &ssm.GetParameterInput{Name: &name, WithDecryption: &withDecryption})
+	if err != nil {
+		return nil, err
+	}
+	return parseLaunchSpec([]byte(*result.Parameter.Value))
+}
+
+func parseLaunchSpec(content []byte) (*launchSpec, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	var spec launchSpec
+	if err := decoder.Decode(&spec); err != nil {
+		return nil, fmt.Errorf("malformed launch spec: %v", err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("malformed launch spec: unexpected content after the document")
+	}
+	for _, prefix := range spec.Prefixes {
+		if prefix == "" {
+			return nil, fmt.Errorf("malformed launch spec: empty prefix")
+		}
+	}
+	if len(spec.Command) > 0 && spec.Command[0] == "" {
+		return nil, fmt.Errorf("malformed launch spec: empty command")
+	}
+	return &spec, nil
+}
+
+// applyLaunchSpec sets the flags described by spec as if they were given on
+// the command line. Flags and a command that were actually given on the
+// command line take precedence over the spec.
+func applyLaunchSpec(c *cli.Context, spec *launchSpec) error {
+	set := func(name string, values ...string) error {
+		if c.GlobalIsSet(name) {
+			return nil
+		}
+		for _, value := range values {
+			if err := c.GlobalSet(name, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := set("prefix", spec.Prefixes...); err != nil {
+		return err
+	}
+	if spec.CommonPrefix != "" {
+		if err := set("common-prefix", spec.CommonPrefix); err != nil {
+			return err
+		}
+	}
+	if spec.LongEnvName != nil {
+		if err := set("long-env-name", strconv.FormatBool(*spec.LongEnvName)); err != nil {
+			return err
+		}
+	}
+	if spec.NoExpand != nil {
+		if err := set("no-expand", strconv.FormatBool(*spec.NoExpand)); err != nil {
+			return err
+		}
+	}
+	if err := set("procfile", spec.Procfiles...); err != nil {
+		return err
+	}
+
+	if c.NArg() == 0 && len(spec.Command) > 0 {
+		c.App.Metadata["command"] = cli.Args(spec.Command)
+	}
+	return nil
+}
+
+// commandLine returns the command to run and its arguments, taken from the
+// command line or, if none was given there, from the launch spec.
+func commandLine(c *cli.Context) cli.Args {
+	if c.NArg() == 0 {
+		if args, ok := c.App.Metadata["command"].(cli.Args); ok {
+			return args
+		}
+	}
+	return c.Args()
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// parameterCache is the content of the --cache-file, the resolved parameters
+// of every set of prefixes fetched with it
+type parameterCache struct {
+	Entries map[string]cacheEntry `json:"entries"`
+}
+
+type cacheEntry struct {
+	FetchedAt  time.Time           `json:"fetched_at"`
+	Parameters []resolvedParameter `json:"parameters"`
+}
+
+// uncachedFlags don't affect which parameters are fetched or how they are
+// named, resolved and decoded, so they are left out of the cache key. Every
+// other flag is part of it, so a flag added later can't silently reuse a
+// cache written without it.
+var uncachedFlags = map[string]bool{
+	"config": true, "cache-file": true, "cache-ttl": true, "refresh-cache": true,
+	"debug": true, "log-level": true, "log-format": true, "silent": true, "unmask": true,
+	"verbose-errors": true, "json": true, "debug-signal": true, "run-id-var": true,
+	"procfile": true, "test": true, "tty": true, "all": true, "exec": true, "no-new-privs": true,
+	"forward-signals": true, "shutdown-timeout": true, "oom-exit-code": true, "unknown-command": true,
+	"agent-socket": true, "agent-refresh": true, "secrets-via-memfd": true, "as-flag": true,
+	"health-command": true, "health-interval": true, "health-start-period": true, "health-retries": true,
+	"restart-backoff": true, "restart-backoff-max": true, "max-restarts": true, "restart-window": true,
+	"concurrency": true, "fetch-timeout": true, "prefix-timeout": true, "report-all-errors": true,
+	"connect-timeout": true, "tls-handshake-timeout": true, "response-header-timeout": true,
+	"max-retries": true, "retry-base-delay": true,
+	"verify-consistency": true, "detect-plaintext-secrets": true, "report-param-age": true, "decryption-report": true,
+	"write-fd": true, "dry-run": true, "export": true, "render": true, "dump-env": true, "ecs-metadata": true,
+	"validate": true, "auto-offload-threshold": true, "offload-dir": true,
+	"write-snapshot": true, "pin-snapshot": true, "fail-on-drift": true, "since": true, "update-since": true,
+	"emit-dotenv-var": true, "emit-dotenv-only": true,
+	// applied by getParameters to the cached parameters
+	"fail-on-collision": true, "stringlist-expand": true, "no-overwrite": true,
+	"no-expand": true, "expand-only": true, "expand-args": true,
+}
+
+// cacheEnvVars are the environment variables besides the flags that select
+// where the parameters are fetched from
+var cacheEnvVars = []string{"AWS_REGION", "AWS_DEFAULT_REGION", "AWS_PROFILE", "VAULT_ADDR"}
+
+// cacheKey identifies the parameters of a fetch by the effective values of
+// all flags that affect fetching or naming, hashed to keep the cache small.
+func cacheKey(c *cli.Context) string {
+	var parts []string
+	for _, f := range c.App.Flags {
+		name := flagNames(f)[0]
+		if uncachedFlags[name] || name == "help" || name == "version" {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s=%v", name, c.GlobalGeneric(name)))
+	}
+	for _, name := range cacheEnvVars {
+		parts = append(parts, name+"="+os.Getenv(name))
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// fetchCachedParameters returns the parameters from the --cache-file if they
+// were fetched less than --cache-ttl ago, and fetches them and updates the
+// cache otherwise. An unreadable cache is treated like an expired one.
+func fetchCachedParameters(ctx context.Context, c *cli.Context) ([]resolvedParameter, error) {
+	file := c.GlobalString("cache-file")
+	if file == "" {
+		return fetchParameters(ctx, c)
+	}
+
+	key := cacheKey(c)
+	cache, err := readCache(file)
+	if err != nil {
+		log.WithError(err).WithField("cache", file).Warn("ignoring unreadable cache, fetching the parameters")
+		cache = parameterCache{}
+	}
+	entry, ok := cache.Entries[key]
+	age := time.Since(entry.FetchedAt)
+	if ok && !c.GlobalBool("refresh-cache") && age < c.GlobalDuration("cache-ttl") {
+		log.WithField("cache", file).WithField("age", age.Round(time.Second).String()).Debug("using cached parameters")
+		registerParameterSecrets(entry.Parameters)
+		state.setParameters(entry.Parameters)
+		return entry.Parameters, nil
+	}
+
+	parameters, err := fetchParameters(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if cache.Entries == nil {
+		cache.Entries = map[string]cacheEntry{}
+	}
+	cache.Entries[key] = cacheEntry{FetchedAt: time.Now(), Parameters: parameters}
+	if err := writeCache(file, cache); err != nil {
+		log.WithError(err).WithField("cache", file).Warn("unable to write cache")
+	}
+	return parameters, nil
+}
+
+func readCache(file string) (parameterCache, error) {
+	var cache parameterCache
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return cache, err
+	}
+	if err := json.Unmarshal(content, &cache); err != nil {
+		return cache, fmt.Errorf("malformed cache %s: %v", file, err)
+	}
+	for _, entry := range cache.Entries {
+		for _, p := range entry.Parameters {
+			if p.Name == nil || p.Value == nil {
+				return parameterCache{}, fmt.Errorf("malformed cache %s: parameter without name or value", file)
+			}
+		}
+	}
+	return cache, nil
+}
+
+// writeCache replaces the cache file atomically, so concurrent ssm-env
+// processes never read a partial cache. It holds secrets, so it is only
+// readable by the user.
+func writeCache(file string, cache parameterCache) error {
+	content, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(file, content, 0600)
+}
+
+// writeFileAtomic replaces file with content through a temporary file in the
+// same directory, so the file is never seen half written.
+func writeFileAtomic(file string, content []byte, mode os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// temporary files are created with 0600
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
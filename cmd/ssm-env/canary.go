@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// chooseCanary fetches the canary and baseline prefixes, logs how the canary
+// differs from the baseline and returns the canary parameters if the number
+// of differences is within --canary-max-changes, the baseline otherwise.
+func chooseCanary(ctx context.Context, c *cli.Context, svc *ssm.Client) ([]resolvedParameter, error) {
+	canaryPrefix, baselinePrefix := c.GlobalString("canary-prefix"), c.GlobalString("baseline-prefix")
+	canary, err := fetchPrefix(ctx, c, svc, canaryPrefix)
+	if err != nil {
+		return nil, err
+	}
+	baseline, err := fetchPrefix(ctx, c, svc, baselinePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := diffParameters(baseline, canary)
+	entry := log.WithField("canary", canaryPrefix).WithField("baseline", baselinePrefix)
+	diff.log(entry)
+
+	if maxChanges := c.GlobalInt("canary-max-changes"); maxChanges >= 0 && diff.Len() > maxChanges {
+		entry.WithField("changes", diff.Len()).WithField("max_changes", maxChanges).Warn("canary has too many changes, applying baseline")
+		return baseline, nil
+	}
+	entry.WithField("changes", diff.Len()).Info("applying canary")
+	return canary, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// checkCollisions warns about parameters of different prefixes that map to
+// the same env name, so the later one silently overrides the earlier one.
+// With --fail-on-collision the first collision is returned as an error.
+// Values of the common prefix are meant to be overridden and don't count, nor
+// do StringLists merged by --merge-lists.
+func checkCollisions(c *cli.Context, parameters []resolvedParameter) error {
+	common := ""
+	if c.GlobalString("common-prefix") != "" {
+		_, prefix := splitPrefixLabel(c.GlobalString("common-prefix"))
+		_, path := splitRegionPrefix(prefix)
+		common = normalizePrefix(path)
+	}
+
+	mergeLists := c.GlobalBool("merge-lists")
+	seen := map[string]resolvedParameter{}
+	for _, p := range parameters {
+		prev, ok := seen[p.EnvName]
+		seen[p.EnvName] = p
+		if !ok || (prev.Prefix == p.Prefix && prev.Region == p.Region) || (common != "" && prev.Prefix == common) {
+			continue
+		}
+		if mergeLists && prev.Type == types.ParameterTypeStringList && p.Type == types.ParameterTypeStringList {
+			continue
+		}
+		if c.GlobalBool("fail-on-collision") {
+			return fmt.Errorf("%s and %s both map to %s", qualifiedName(prev), qualifiedName(p), p.EnvName)
+		}
+		log.WithField("name", p.EnvName).
+			WithField("overridden", qualifiedName(prev)).
+			WithField("parameter", qualifiedName(p)).
+			Warn("parameters of different prefixes map to the same env var")
+	}
+	return nil
+}
+
+// qualifiedName returns the name of p, prefixed with its region if it was
+// fetched from a region-qualified prefix.
+func qualifiedName(p resolvedParameter) string {
+	if p.Region != "" {
+		return p.Region + ":" + *p.Name
+	}
+	return *p.Name
+}
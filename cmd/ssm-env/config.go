@@ -0,0 +1,157 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v3"
+)
+
+// loadConfigFile sets the global flags listed in the --config file. Flags
+// given on the command line take precedence over the file, and the file takes
+// precedence over the environment variables of the flags.
+func loadConfigFile(c *cli.Context) error {
+	file := c.GlobalString("config")
+	if file == "" {
+		return nil
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	settings, err := parseConfigFile(content)
+	if err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+
+	flags := map[string]cli.Flag{}
+	for _, f := range c.App.Flags {
+		for _, name := range flagNames(f) {
+			flags[name] = f
+		}
+	}
+	given := commandLineFlags(c.App.Flags, os.Args[1:])
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		f, ok := flags[key]
+		if !ok || key == "config" || key == "help" || key == "version" {
+			return fmt.Errorf("%s: unknown option %q", file, key)
+		}
+		names := flagNames(f)
+		if given[names[0]] {
+			continue
+		}
+		if err := setFlag(c, names[0], settings[key]); err != nil {
+			return fmt.Errorf("%s: %s: %v", file, key, err)
+		}
+	}
+	return nil
+}
+
+// parseConfigFile parses a YAML mapping of option names to scalar values, or
+// lists of them for options that support multiple use.
+func parseConfigFile(content []byte) (map[string][]string, error) {
+	var document map[string]interface{}
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, fmt.Errorf("malformed config file: %v", err)
+	}
+
+	settings := make(map[string][]string, len(document))
+	for key, value := range document {
+		switch v := value.(type) {
+		case []interface{}:
+			values := make([]string, 0, len(v))
+			for _, item := range v {
+				s, err := configScalar(item)
+				if err != nil {
+					return nil, fmt.Errorf("malformed config file: %s: %v", key, err)
+				}
+				values = append(values, s)
+			}
+			settings[key] = values
+		default:
+			s, err := configScalar(v)
+			if err != nil {
+				return nil, fmt.Errorf("malformed config file: %s: %v", key, err)
+			}
+			settings[key] = []string{s}
+		}
+	}
+	return settings, nil
+}
+
+func configScalar(value interface{}) (string, error) {
+	switch value.(type) {
+	case string, bool, int, float64:
+		return fmt.Sprint(value), nil
+	case nil:
+		return "", fmt.Errorf("missing value")
+	default:
+		return "", fmt.Errorf("expected a value or a list of values")
+	}
+}
+
+// setFlag sets a global flag to values, replacing the value it got from its
+// environment variable.
+func setFlag(c *cli.Context, name string, values []string) error {
+	if slice, ok := c.GlobalGeneric(name).(*cli.StringSlice); ok {
+		*slice = cli.StringSlice{}
+	} else if len(values) != 1 {
+		return fmt.Errorf("expected a single value")
+	}
+	for _, value := range values {
+		if err := c.GlobalSet(name, value); err != nil {
+			return fmt.Errorf("invalid value %q: %v", value, err)
+		}
+	}
+	return nil
+}
+
+// commandLineFlags returns the names of the flags given in args. Unlike
+// GlobalIsSet it doesn't count flags that are only set by their environment
+// variable, which the config file overrides.
+func commandLineFlags(flags []cli.Flag, args []string) map[string]bool {
+	set := flag.NewFlagSet("ssm-env", flag.ContinueOnError)
+	set.SetOutput(ioutil.Discard)
+	for _, f := range flags {
+		f.Apply(set)
+	}
+	// the command line was already validated by the cli package
+	_ = set.Parse(args)
+
+	visited := map[string]bool{}
+	set.Visit(func(f *flag.Flag) {
+		visited[f.Name] = true
+	})
+	given := map[string]bool{}
+	for _, f := range flags {
+		names := flagNames(f)
+		for _, name := range names {
+			if visited[name] {
+				given[names[0]] = true
+			}
+		}
+	}
+	return given
+}
+
+// flagNames returns the names of a flag, the long name first.
+func flagNames(f cli.Flag) []string {
+	var names []string
+	for _, name := range strings.Split(f.GetName(), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
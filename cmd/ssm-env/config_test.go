@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+// runWithConfig runs ssm-env with args up to its action, loading the --config
+// file like main does, and returns the context of the action.
+func runWithConfig(t *testing.T, args ...string) (*cli.Context, error) {
+	t.Helper()
+	defer func(args []string) { os.Args = args }(os.Args)
+	os.Args = append([]string{"ssm-env"}, args...)
+
+	var action *cli.Context
+	app := cli.NewApp()
+	app.Name = "ssm-env"
+	app.Flags = cliFlags()
+	app.Before = loadConfigFile
+	app.Action = func(c *cli.Context) error {
+		action = c
+		return nil
+	}
+	err := app.Run(os.Args)
+	return action, err
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "ssm-env.yaml")
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestConfigFilePrecedence(t *testing.T) {
+	file := writeConfigFile(t, `
+prefix:
+  - /from/file
+  - /also/from/file
+unknown-command: shell
+region: eu-west-1
+long-env-name: true
+`)
+	t.Setenv("PARAMS_PREFIX", "/from/env")
+	t.Setenv("UNKNOWN_COMMAND", "error")
+	t.Setenv("CONCURRENCY", "2")
+
+	c, err := runWithConfig(t, "--config", file, "-p", "/from/cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the command line wins over the file, the file over the environment
+	if got := strings.Join(c.GlobalStringSlice("prefix"), ","); got != "/from/cli" {
+		t.Errorf("prefix = %s, want /from/cli", got)
+	}
+	if got := c.GlobalString("unknown-command"); got != "shell" {
+		t.Errorf("unknown-command = %s, want the shell of the file", got)
+	}
+	if got := c.GlobalInt("concurrency"); got != 2 {
+		t.Errorf("concurrency = %d, want the 2 of the environment", got)
+	}
+	if got := c.GlobalString("region"); got != "eu-west-1" {
+		t.Errorf("region = %s, want the eu-west-1 of the file", got)
+	}
+	if !c.GlobalBool("long-env-name") {
+		t.Errorf("long-env-name is not set, want it set by the file")
+	}
+
+	c, err = runWithConfig(t, "--config", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(c.GlobalStringSlice("prefix"), ","); got != "/from/file,/also/from/file" {
+		t.Errorf("prefix = %s, want the prefixes of the file", got)
+	}
+}
+
+func TestConfigFileErrors(t *testing.T) {
+	tests := map[string]string{
+		"unknown option":  "no-such-option: true\n",
+		"config option":   "config: other.yaml\n",
+		"malformed":       "prefix: [/app\n",
+		"nested mapping":  "prefix:\n  path: /app\n",
+		"missing value":   "region:\n",
+		"list for scalar": "region: [eu-west-1, us-east-1]\n",
+		"invalid value":   "concurrency: many\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := runWithConfig(t, "--config", writeConfigFile(t, content)); err == nil {
+				t.Errorf("loading %q succeeded, want an error", content)
+			}
+		})
+	}
+}
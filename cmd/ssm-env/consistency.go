@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// verifyConsistency re-reads the versions of the fetched SSM parameters and
+// warns about every parameter that was changed or deleted while the prefixes
+// were being fetched. SSM has no snapshots, so this detects an inconsistent
+// view rather than preventing it.
+func verifyConsistency(ctx context.Context, c *cli.Context, parameters []resolvedParameter) error {
+	// parameters of region-qualified prefixes are re-read in their region
+	fetched := map[string]map[string]int64{}
+	names := map[string][]string{}
+	var regions []string
+	for _, p := range parameters {
+		if p.Source != sourceSSM {
+			continue
+		}
+		if fetched[p.Region] == nil {
+			fetched[p.Region] = map[string]int64{}
+			regions = append(regions, p.Region)
+		}
+		if _, ok := fetched[p.Region][*p.Name]; !ok {
+			names[p.Region] = append(names[p.Region], *p.Name)
+		}
+		fetched[p.Region][*p.Name] = p.Version
+	}
+
+	var maxVersion int64
+	checked, shifted := 0, 0
+	for _, region := range regions {
+		svc, err := newRegionalSSMClient(ctx, c, region)
+		if err != nil {
+			return err
+		}
+		current, deleted, err := getParametersByName(ctx, svc, names[region], false)
+		if err != nil {
+			return err
+		}
+		checked += len(names[region])
+
+		for _, p := range current {
+			if p.Version > maxVersion {
+				maxVersion = p.Version
+			}
+			if p.Version != fetched[region][*p.Name] {
+				shifted++
+				log.WithField("name", *p.Name).WithField("fetched_version", fetched[region][*p.Name]).WithField("current_version", p.Version).Warn("parameter changed while fetching")
+			}
+		}
+		for _, name := range deleted {
+			shifted++
+			log.WithField("name", name).Warn("parameter deleted while fetching")
+		}
+	}
+
+	if shifted == 0 {
+		log.WithField("parameters", checked).WithField("max_version", maxVersion).Debug("fetched parameters are consistent")
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// supervisorState is the internal state logged on --debug-signal
+type supervisorState struct {
+	mu         sync.Mutex
+	fetchedAt  time.Time
+	parameters []resolvedParameter
+	childPID   int
+}
+
+var state supervisorState
+
+func (s *supervisorState) setParameters(parameters []resolvedParameter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetchedAt = time.Now()
+	s.parameters = parameters
+}
+
+func (s *supervisorState) setChildPID(pid int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.childPID = pid
+}
+
+// parseSignal looks up a signal by name, with or without the SIG prefix.
+func parseSignal(name string) (os.Signal, error) {
+	sig, ok := signalsByName[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		return nil, fmt.Errorf("unsupported signal %q", name)
+	}
+	return sig, nil
+}
+
+// watchDebugSignal logs the supervisor state every time --debug-signal is
+// received until the returned stop function is called. It uses its own
+// channel, so a debug signal that is also forwarded still reaches the child.
+func watchDebugSignal(c *cli.Context) func() {
+	name := c.GlobalString("debug-signal")
+	if name == "" {
+		return func() {}
+	}
+	sig, err := parseSignal(name)
+	if err != nil {
+		return func() {}
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigCh, sig)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-sigCh:
+				logDebugState(c)
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigCh)
+		close(done)
+	}
+}
+
+// logDebugState logs the prefixes, the last fetch, the child PID and the
+// fetched parameters with their values masked.
+func logDebugState(c *cli.Context) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	entry := log.WithField("prefixes", strings.Join(prefixes(c), ",")).WithField("child_pid", state.childPID)
+	if !state.fetchedAt.IsZero() {
+		entry = entry.WithField("fetched_at", state.fetchedAt.Format(time.RFC3339)).WithField("fetched_ago", time.Since(state.fetchedAt).Round(time.Second).String())
+	}
+	entry.WithField("parameters", len(state.parameters)).Info("debug state")
+
+	for _, p := range state.parameters {
+		log.WithField("name", *p.Name).
+			WithField("env", p.EnvName).
+			WithField("source", p.Source).
+			WithField("version", p.Version).
+			WithField("value", maskValue(*p.Value)).
+			Info("debug parameter")
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/urfave/cli"
+)
+
+// decodeParameters replaces the values of the parameters named by
+// --gzip-decode with their base64 decoded and gunzipped content.
+func decodeParameters(c *cli.Context, parameters []resolvedParameter) error {
+	gzipKeys := map[string]bool{}
+	for _, name := range c.GlobalStringSlice("gzip-decode") {
+		gzipKeys[name] = true
+	}
+	if len(gzipKeys) == 0 {
+		return nil
+	}
+
+	for i, p := range parameters {
+		if !gzipKeys[p.EnvName] {
+			continue
+		}
+		value, err := gunzipBase64(*p.Value)
+		if err != nil {
+			return fmt.Errorf("unable to gzip-decode %s (%s): %v", p.EnvName, *p.Name, err)
+		}
+		parameters[i].Value = &value
+	}
+	return nil
+}
+
+func gunzipBase64(value string) (string, error) {
+	compressed, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", err
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
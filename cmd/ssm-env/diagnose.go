@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/aws/smithy-go"
+	"github.com/urfave/cli"
+)
+
+// remediations suggests a fix for the AWS error codes commonly hit at startup
+var remediations = map[string]string{
+	"AccessDeniedException":                "check that the IAM role allows ssm:GetParametersByPath (and kms:Decrypt for SecureStrings) on the prefixes",
+	"ThrottlingException":                  "SSM is throttling requests, raise --max-retries or --retry-base-delay or lower --concurrency",
+	"ParameterNotFound":                    "check that the parameter exists in the region ssm-env uses",
+	"ValidationException":                  "check that all prefixes and parameter names are valid, prefixes have to start with /",
+	"UnrecognizedClientException":          "the AWS credentials are invalid, check the access key",
+	"ExpiredTokenException":                "the AWS session token expired, refresh the credentials",
+	"InvalidSignatureException":            "the AWS secret key is invalid or the system clock is off",
+	"ResourceNotFoundException":            "check that the secret exists in the region ssm-env uses",
+	"KMSAccessDeniedException":             "check that the IAM role allows kms:Decrypt on the key of the SecureString parameters",
+	"InvalidKeyId":                         "check the KMS key of the SecureString parameters",
+	"ParameterVersionNotFound":             "check the version of the parameter",
+	"InternalServerError":                  "SSM failed internally, retry or raise --max-retries",
+	"UnsupportedParameterType":             "check the type of the parameter",
+	"HierarchyLevelLimitExceededException": "the parameter path is too deep",
+}
+
+// phaseRemediations suggests a fix when the error has no AWS error code
+var phaseRemediations = map[string]string{
+	"load config file":  "check that the config file exists and only sets global options, see --help",
+	"configure logging": "check --log-level and --log-format, see --help for the accepted values",
+	"bootstrap":         "check that the bootstrap parameter exists and holds a valid launch spec",
+	"validate options":  "check the options, see --help",
+	"fetch parameters":  "check the AWS credentials and region and that the prefixes exist",
+	"validate values":   "check the values of the parameters named in the error against --validate",
+	"render templates":  "check that the templates exist, parse and only reference resolved parameters",
+	"run command":       "check that the command exists and is executable",
+}
+
+// failure returns the exit error of a failed startup phase. With
+// --verbose-errors the message is a multi-line summary of the phase, the AWS
+// error code, the prefixes and a suggested remediation.
+func failure(c *cli.Context, phase string, err error, code int) *cli.ExitError {
+	if !c.GlobalBool("verbose-errors") {
+		return cli.NewExitError(errorPrefix(err), code)
+	}
+	return cli.NewExitError(explainFailure(c, phase, err), code)
+}
+
+func explainFailure(c *cli.Context, phase string, err error) string {
+	var sb strings.Builder
+	// exit errors of the run phase already carry the prefix
+	if message := err.Error(); strings.HasPrefix(message, "ERROR: ") {
+		sb.WriteString(message + "\n")
+	} else {
+		sb.WriteString(errorPrefix(err) + "\n")
+	}
+	fmt.Fprintf(&sb, "  phase:       %s\n", phase)
+
+	remediation := phaseRemediations[phase]
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		fmt.Fprintf(&sb, "  aws error:   %s\n", apiErr.ErrorCode())
+		if r, ok := remediations[apiErr.ErrorCode()]; ok {
+			remediation = r
+		}
+	} else if strings.Contains(err.Error(), "failed to retrieve credentials") {
+		remediation = "no AWS credentials found, set AWS_PROFILE or the AWS_ACCESS_KEY_ID variables, or run with an IAM role"
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		remediation = "the command is not in $PATH, check its name or use an absolute path"
+	}
+
+	if all := prefixes(c); len(all) > 0 {
+		fmt.Fprintf(&sb, "  prefixes:    %s\n", strings.Join(all, ", "))
+	}
+	if names := c.GlobalStringSlice("param"); len(names) > 0 {
+		fmt.Fprintf(&sb, "  parameters:  %s\n", strings.Join(names, ", "))
+	}
+	if remediation != "" {
+		fmt.Fprintf(&sb, "  remediation: %s\n", remediation)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
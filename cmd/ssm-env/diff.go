@@ -0,0 +1,67 @@
+package main
+
+import (
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// parameterDiff lists the env names added, removed or changed between two
+// sets of parameters
+type parameterDiff struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+// diffParameters compares the env vars resulting from from and to. When a
+// name occurs multiple times in a set the last occurrence wins, as it does
+// when the parameters are applied.
+func diffParameters(from, to []resolvedParameter) parameterDiff {
+	fromValues, toValues := envValues(from), envValues(to)
+
+	var diff parameterDiff
+	for name, value := range toValues {
+		fromValue, ok := fromValues[name]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, name)
+		case fromValue != value:
+			diff.Changed = append(diff.Changed, name)
+		}
+	}
+	for name := range fromValues {
+		if _, ok := toValues[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return diff
+}
+
+func envValues(parameters []resolvedParameter) map[string]string {
+	values := map[string]string{}
+	for _, p := range parameters {
+		values[p.EnvName] = *p.Value
+	}
+	return values
+}
+
+func (d parameterDiff) Len() int {
+	return len(d.Added) + len(d.Removed) + len(d.Changed)
+}
+
+// log writes one line per difference. Values are never logged.
+func (d parameterDiff) log(entry *log.Entry) {
+	for _, name := range d.Added {
+		entry.WithField("name", name).Info("variable added")
+	}
+	for _, name := range d.Removed {
+		entry.WithField("name", name).Info("variable removed")
+	}
+	for _, name := range d.Changed {
+		entry.WithField("name", name).Info("variable value changed")
+	}
+}
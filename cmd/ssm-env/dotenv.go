@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var dotenvNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type envVar struct {
+	Name  string
+	Value string
+}
+
+// parseDotenv parses KEY=value lines as found in .env files. Blank lines and
+// lines starting with # are ignored, an optional leading "export " is allowed.
+// Single quoted values are taken literally, double quoted values support the
+// \n, \r, \t, \" and \\ escapes and may span multiple lines. Unquoted values
+// are trimmed and end at an inline " #" comment.
+func parseDotenv(content []byte) ([]envVar, error) {
+	var vars []envVar
+	lines := strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		pair := strings.SplitN(line, "=", 2)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("line %d: expected KEY=value", lineNo)
+		}
+		name, value := strings.TrimSpace(pair[0]), strings.TrimLeft(pair[1], " \t")
+		if !dotenvNameRegex.MatchString(name) {
+			return nil, fmt.Errorf("line %d: invalid variable name %q", lineNo, name)
+		}
+
+		switch {
+		case strings.HasPrefix(value, "'"):
+			end := strings.Index(value[1:], "'")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated single quoted value", lineNo)
+			}
+			value = value[1 : end+1]
+		case strings.HasPrefix(value, `"`):
+			// keep consuming lines until we find the closing quote
+			raw := value[1:]
+			for closingQuote(raw) < 0 && i+1 < len(lines) {
+				i++
+				raw += "\n" + lines[i]
+			}
+			end := closingQuote(raw)
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated double quoted value", lineNo)
+			}
+			value = unescapeDoubleQuoted(raw[:end])
+		default:
+			if idx := strings.Index(value, " #"); idx >= 0 {
+				value = value[:idx]
+			}
+			value = strings.TrimSpace(value)
+		}
+
+		vars = append(vars, envVar{Name: name, Value: value})
+	}
+	return vars, nil
+}
+
+// closingQuote returns the index of the first unescaped double quote in s.
+func closingQuote(s string) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func unescapeDoubleQuoted(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case '"', '\\', '$':
+			sb.WriteByte(s[i])
+		default:
+			sb.WriteByte('\\')
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String()
+}
+
+// formatDotenv serializes vars as KEY="value" lines that parseDotenv reads
+// back unchanged. Values are always double quoted with \, ", $ and control
+// characters escaped, so they can hold newlines and quotes.
+func formatDotenv(vars []envVar) string {
+	var sb strings.Builder
+	for _, v := range vars {
+		sb.WriteString(v.Name)
+		sb.WriteString("=")
+		sb.WriteString(quoteDotenvValue(v.Value))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func quoteDotenvValue(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + replacer.Replace(value) + `"`
+}
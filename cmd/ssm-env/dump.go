@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+var tfvarsInvalidChars = regexp.MustCompile(`[^a-z0-9_]`)
+
+// dumpEntry is a resolved env var together with the path and origin of the
+// parameter it was set from.
+type dumpEntry struct {
+	envVar
+	Path string
+	// Origin is the prefix, secret or parameter the value was loaded from
+	Origin string
+}
+
+// dumpFormats maps the --format names to their serializers.
+var dumpFormats = map[string]func([]dumpEntry) (string, error){
+	"dotenv":     func(entries []dumpEntry) (string, error) { return formatDotenv(entryVars(entries)), nil },
+	"tfvars":     func(entries []dumpEntry) (string, error) { return formatTfvars(entryVars(entries)) },
+	"shell":      func(entries []dumpEntry) (string, error) { return formatShell(entryVars(entries)), nil },
+	"ini":        formatINI,
+	"properties": formatProperties,
+	"json":       formatJSON,
+}
+
+func dumpCommand() cli.Command {
+	return cli.Command{
+		Name:      "dump",
+		Usage:     "Print the resolved parameters instead of running a command",
+		UsageText: "ssm-env -p prefix dump [--format dotenv|shell|tfvars|ini|properties|json] [--dump-comments]",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "format, dump-format",
+				Value: "dotenv",
+				Usage: "Output format (dotenv|shell|tfvars|ini|properties|json)",
+			},
+			cli.BoolFlag{
+				Name:  "dump-comments",
+				Usage: "Group the output by the prefix the values were loaded from, with a comment naming it before each group (not for ini and json)",
+			},
+		},
+		Action: dumpAction,
+	}
+}
+
+func dumpAction(c *cli.Context) error {
+	if err := configureLogging(c); err != nil {
+		return cli.NewExitError(errorPrefix(err), ValidateArgsError)
+	}
+	// stdout is reserved for the output
+	if !c.GlobalBool("silent") {
+		log.SetOutput(os.Stderr)
+	}
+
+	if err := validateDumpArgs(c); err != nil {
+		return cli.NewExitError(errorPrefix(err), ValidateArgsError)
+	}
+
+	parameters, err := getParameters(c)
+	if err != nil {
+		return cli.NewExitError(errorPrefix(err), GetParametersError)
+	}
+
+	format := dumpFormats[c.String("format")]
+	if c.Bool("dump-comments") {
+		format = withOriginComments(format)
+	}
+	output, err := format(dumpEntries(parameters))
+	if err != nil {
+		return cli.NewExitError(errorPrefix(err), WriteOutputError)
+	}
+	if _, err := os.Stdout.WriteString(output); err != nil {
+		return cli.NewExitError(errorPrefix(err), WriteOutputError)
+	}
+	return nil
+}
+
+func validateDumpArgs(c *cli.Context) error {
+	if len(prefixes(c)) == 0 && len(c.GlobalStringSlice("param")) == 0 && len(c.GlobalStringSlice("secrets-prefix")) == 0 && c.GlobalString("canary-prefix") == "" {
+		return errors.New("prefix, param or secrets-prefix is required")
+	}
+	if c.GlobalInt("concurrency") < 1 {
+		return errors.New("concurrency must be at least 1")
+	}
+	if _, err := parseTagFilters(c.GlobalStringSlice("tag-filter")); err != nil {
+		return err
+	}
+	if err := validatePrefixLabels(c); err != nil {
+		return err
+	}
+	if _, ok := dumpFormats[c.String("format")]; !ok {
+		return fmt.Errorf("invalid format %q, expected dotenv, shell, tfvars, ini, properties or json", c.String("format"))
+	}
+	if c.Bool("dump-comments") && (c.String("format") == "ini" || c.String("format") == "json") {
+		return fmt.Errorf("dump-comments is not supported by the %s format", c.String("format"))
+	}
+	return nil
+}
+
+// dumpEntries returns the resolved vars like resolvedVars does, each with the
+// path of the parameter that won for its name.
+func dumpEntries(parameters []resolvedParameter) []dumpEntry {
+	paths := map[string]string{}
+	origins := map[string]string{}
+	for _, p := range parameters {
+		name := strings.TrimPrefix(*p.Name, sourceVault+":")
+		paths[p.EnvName] = strings.TrimPrefix(name, sourceSecretsManager+":")
+		origins[p.EnvName] = p.Prefix
+		if p.Prefix == "" {
+			origins[p.EnvName] = *p.Name
+		}
+	}
+
+	vars := resolvedVars(parameters)
+	entries := make([]dumpEntry, 0, len(vars))
+	for _, v := range vars {
+		entries = append(entries, dumpEntry{envVar: v, Path: paths[v.Name], Origin: origins[v.Name]})
+	}
+	return entries
+}
+
+// withOriginComments wraps a line based format to group the entries by their
+// origin, sorted by name, each group headed by a "# from <origin>" comment.
+func withOriginComments(format func([]dumpEntry) (string, error)) func([]dumpEntry) (string, error) {
+	return func(entries []dumpEntry) (string, error) {
+		var origins []string
+		groups := map[string][]dumpEntry{}
+		for _, e := range entries {
+			if _, ok := groups[e.Origin]; !ok {
+				origins = append(origins, e.Origin)
+			}
+			groups[e.Origin] = append(groups[e.Origin], e)
+		}
+		sort.Strings(origins)
+
+		var sb strings.Builder
+		for i, origin := range origins {
+			output, err := format(groups[origin])
+			if err != nil {
+				return "", err
+			}
+			if i > 0 {
+				sb.WriteString("\n")
+			}
+			// a line break in the origin would end the comment
+			sb.WriteString("# from " + strings.NewReplacer("\n", " ", "\r", " ").Replace(origin) + "\n")
+			sb.WriteString(output)
+		}
+		return sb.String(), nil
+	}
+}
+
+func entryVars(entries []dumpEntry) []envVar {
+	vars := make([]envVar, 0, len(entries))
+	for _, e := range entries {
+		vars = append(vars, e.envVar)
+	}
+	return vars
+}
+
+// tfvarsName turns an env name into a Terraform variable name: lowercased,
+// with every character Terraform doesn't allow replaced by an underscore.
+func tfvarsName(name string) string {
+	name = tfvarsInvalidChars.ReplaceAllString(strings.ToLower(name), "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+// formatTfvars serializes vars as `name = "value"` tfvars lines. Values are
+// HCL string literals, so template sequences are escaped as well.
+func formatTfvars(vars []envVar) (string, error) {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`, "${", "$${", "%{", "%%{")
+
+	var sb strings.Builder
+	seen := map[string]string{}
+	for _, v := range vars {
+		name := tfvarsName(v.Name)
+		if other, ok := seen[name]; ok {
+			return "", fmt.Errorf("%s and %s both map to the tfvars variable %s", other, v.Name, name)
+		}
+		seen[name] = v.Name
+		sb.WriteString(name + " = \"" + replacer.Replace(v.Value) + "\"\n")
+	}
+	return sb.String(), nil
+}
+
+// formatShell serializes vars as single quoted KEY='value' shell assignments,
+// which are exported when sourced after `set -a`.
+func formatShell(vars []envVar) string {
+	var sb strings.Builder
+	for _, v := range vars {
+		sb.WriteString(v.Name + "=" + shellQuote(v.Value) + "\n")
+	}
+	return sb.String()
+}
+
+// formatINI serializes the entries as INI with one section per parameter
+// directory and the env names as keys, e.g. /app/db/HOST becomes HOST in
+// section [app.db]. Values are double quoted, with backslashes, quotes and
+// control characters escaped.
+func formatINI(entries []dumpEntry) (string, error) {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+	sections := map[string][]dumpEntry{}
+	for _, e := range entries {
+		section := strings.ReplaceAll(strings.Trim(path.Dir(e.Path), "/."), "/", ".")
+		sections[section] = append(sections[section], e)
+	}
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		// keys outside of any section have to come first
+		if name != "" {
+			sb.WriteString("[" + name + "]\n")
+		}
+		// keys have to be unique within a section
+		seen := map[string]bool{}
+		for _, e := range sections[name] {
+			if seen[e.Name] {
+				return "", fmt.Errorf("%s is set more than once in the ini section [%s]", e.Name, name)
+			}
+			seen[e.Name] = true
+			sb.WriteString(e.Name + " = \"" + replacer.Replace(e.Value) + "\"\n")
+		}
+	}
+	return sb.String(), nil
+}
+
+// formatProperties serializes the entries as Java properties, with the env
+// names lowercased and underscores turned into dots, e.g. DB_HOST becomes
+// db.host. Keys and values are escaped as java.util.Properties reads them,
+// with everything outside of printable ASCII as \uXXXX.
+func formatProperties(entries []dumpEntry) (string, error) {
+	var sb strings.Builder
+	seen := map[string]string{}
+	for _, e := range entries {
+		key := strings.ReplaceAll(strings.ToLower(e.Name), "_", ".")
+		if other, ok := seen[key]; ok {
+			return "", fmt.Errorf("%s and %s both map to the property %s", other, e.Name, key)
+		}
+		seen[key] = e.Name
+		sb.WriteString(escapeProperty(key, true) + "=" + escapeProperty(e.Value, false) + "\n")
+	}
+	return sb.String(), nil
+}
+
+func escapeProperty(s string, key bool) string {
+	var sb strings.Builder
+	for i, r := range s {
+		switch {
+		case r == '\\':
+			sb.WriteString(`\\`)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == '\r':
+			sb.WriteString(`\r`)
+		case r == '\t':
+			sb.WriteString(`\t`)
+		case r == '\f':
+			sb.WriteString(`\f`)
+		case r == '=' || r == ':' || r == '#' || r == '!':
+			sb.WriteRune('\\')
+			sb.WriteRune(r)
+		case r == ' ' && (key || i == 0):
+			// leading whitespace of values is stripped when reading
+			sb.WriteString(`\ `)
+		case r < 0x20 || r > 0x7e:
+			for _, u := range utf16.Encode([]rune{r}) {
+				sb.WriteString(fmt.Sprintf(`\u%04X`, u))
+			}
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// formatJSON serializes the entries as a JSON object of env names to values.
+func formatJSON(entries []dumpEntry) (string, error) {
+	values := map[string]string{}
+	for _, e := range entries {
+		values[e.Name] = e.Value
+	}
+	content, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(content) + "\n", nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// injectECSMetadata sets ECS_* env vars from the ECS task metadata endpoint.
+// It does nothing when not running on ECS.
+func injectECSMetadata(ctx context.Context) error {
+	endpoint := os.Getenv("ECS_CONTAINER_METADATA_URI_V4")
+	if endpoint == "" {
+		endpoint = os.Getenv("ECS_CONTAINER_METADATA_URI")
+	}
+	if endpoint == "" {
+		log.Debug("no ECS metadata endpoint found, skipping ECS metadata")
+		return nil
+	}
+	endpoint = strings.TrimSuffix(endpoint, "/")
+
+	var container struct {
+		Name string
+	}
+	if err := getECSMetadata(ctx, endpoint, &container); err != nil {
+		return err
+	}
+	var task struct {
+		TaskARN  string
+		Cluster  string
+		Family   string
+		Revision string
+	}
+	if err := getECSMetadata(ctx, endpoint+"/task", &task); err != nil {
+		return err
+	}
+
+	for name, value := range map[string]string{
+		"ECS_CONTAINER_NAME": container.Name,
+		"ECS_TASK_ARN":       task.TaskARN,
+		"ECS_CLUSTER":        task.Cluster,
+		"ECS_TASK_FAMILY":    task.Family,
+		"ECS_TASK_REVISION":  task.Revision,
+	} {
+		if value == "" {
+			continue
+		}
+		if err := os.Setenv(name, value); err != nil {
+			return err
+		}
+	}
+	log.WithField("task", task.TaskARN).Debug("injected ECS metadata")
+	return nil
+}
+
+func getECSMetadata(ctx context.Context, url string, v interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to fetch ECS metadata: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to fetch ECS metadata: %s responded with %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// execCommand replaces ssm-env with the command, passing on the environment
+// with the injected parameters. It only returns if the exec failed.
+func execCommand(command string, args []string) error {
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(path, append([]string{command}, args...), os.Environ())
+}
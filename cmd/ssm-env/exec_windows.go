@@ -0,0 +1,7 @@
+package main
+
+import "errors"
+
+func execCommand(command string, args []string) error {
+	return errors.New("exec is not supported on windows")
+}
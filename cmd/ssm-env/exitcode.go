@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// commandExitError is a failure of the command carrying the exit code to
+// pass on: the command's own exit status, or 128 plus the signal number if
+// it was killed by a signal, like shells report it.
+type commandExitError struct {
+	*exec.ExitError
+	code int
+}
+
+func (e commandExitError) ExitCode() int {
+	return e.code
+}
+
+func (e commandExitError) Unwrap() error {
+	return e.ExitError
+}
+
+// withCommandExitCode wraps errors of commands that ran and failed, so ssm-env
+// exits with the same code as the command. Other errors are returned as they
+// are.
+func withCommandExitCode(err error) error {
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return err
+	}
+	code := exitErr.ExitCode()
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		code = 128 + int(status.Signal())
+	}
+	return commandExitError{ExitError: exitErr, code: code}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+func TestCommandExitCodeIsPropagated(t *testing.T) {
+	tests := []struct {
+		helper string
+		code   int
+	}{
+		{helper: "exit 0", code: 0},
+		{helper: "exit 1", code: 1},
+		{helper: "exit 7", code: 7},
+		{helper: "exit 255", code: 255},
+		{helper: "signal 9", code: 137},
+		{helper: "signal 15", code: 143},
+	}
+	for _, tt := range tests {
+		t.Run(tt.helper, func(t *testing.T) {
+			if runtime.GOOS == "windows" && tt.code > 128 {
+				t.Skip("no signals on windows")
+			}
+			t.Setenv(helperEnvVar, tt.helper)
+			var stderr bytes.Buffer
+			defer func(w interface{ Write([]byte) (int, error) }) { cli.ErrWriter = w }(cli.ErrWriter)
+			cli.ErrWriter = &stderr
+
+			err := invoke(newTestContext(t), os.Args[0], nil)
+			if code := exitCode(err); code != tt.code {
+				t.Errorf("exit code %d, want %d (error %v)", code, tt.code, err)
+			}
+			if stderr.Len() > 0 {
+				t.Errorf("printed %q for the failed command, want nothing", stderr.String())
+			}
+		})
+	}
+}
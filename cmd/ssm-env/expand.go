@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// expandValues expands $VAR and ${VAR} references in values. References
+// between entries of values are resolved in dependency order, so chains of
+// any length expand fully in a single pass over the graph, while references
+// to anything else are resolved with fallback. A reference of a variable to
+// itself resolves to its unexpanded value, $$ is a literal dollar sign.
+// Reference cycles between variables are reported as an error.
+func expandValues(values map[string]string, fallback func(string) string) (map[string]string, error) {
+	dependents := map[string][]string{}
+	pending := map[string]int{}
+	for name, value := range values {
+		pending[name] = 0
+		for _, ref := range references(value) {
+			if _, ok := values[ref]; ok && ref != name {
+				dependents[ref] = append(dependents[ref], name)
+				pending[name]++
+			}
+		}
+	}
+
+	var ready []string
+	for name, count := range pending {
+		if count == 0 {
+			ready = append(ready, name)
+		}
+	}
+	sort.Strings(ready)
+
+	expanded := make(map[string]string, len(values))
+	for len(ready) > 0 {
+		name := ready[0]
+		ready = ready[1:]
+		expanded[name] = os.Expand(values[name], func(ref string) string {
+			if ref == "$" {
+				return "$"
+			}
+			if ref == name {
+				return values[name]
+			}
+			if v, ok := expanded[ref]; ok {
+				return v
+			}
+			return fallback(ref)
+		})
+
+		for _, dependent := range dependents[name] {
+			if pending[dependent]--; pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	if len(expanded) < len(values) {
+		var cycle []string
+		for name := range values {
+			if _, ok := expanded[name]; !ok {
+				cycle = append(cycle, name)
+			}
+		}
+		sort.Strings(cycle)
+		return nil, fmt.Errorf("reference cycle between %s", strings.Join(cycle, ", "))
+	}
+	return expanded, nil
+}
+
+// references returns the names of the variables referenced by value, each
+// reference counted once per occurrence.
+func references(value string) []string {
+	var refs []string
+	os.Expand(value, func(ref string) string {
+		if ref != "$" {
+			refs = append(refs, ref)
+		}
+		return ""
+	})
+	return refs
+}
+
+// expandAllowed expands values like expandValues, but if --expand-only is set
+// only the listed names are expanded and all other values are kept literal,
+// also where an expanded value references them.
+func expandAllowed(c *cli.Context, values map[string]string, fallback func(string) string) (map[string]string, error) {
+	only := c.GlobalStringSlice("expand-only")
+	if len(only) == 0 {
+		return expandValues(values, fallback)
+	}
+
+	allowed := map[string]bool{}
+	for _, name := range only {
+		allowed[name] = true
+	}
+	input := make(map[string]string, len(values))
+	for name, value := range values {
+		if !allowed[name] {
+			value = strings.ReplaceAll(value, "$", "$$")
+		}
+		input[name] = value
+	}
+	return expandValues(input, fallback)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// nameMatcher matches full parameter names against a glob, or a regular
+// expression when the pattern starts with "re:"
+type nameMatcher func(string) bool
+
+func parseNameMatcher(pattern string) (nameMatcher, error) {
+	if expr := strings.TrimPrefix(pattern, "re:"); expr != pattern {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	return func(name string) bool {
+		matched, _ := path.Match(pattern, name)
+		return matched
+	}, nil
+}
+
+func parseNameMatchers(patterns []string) ([]nameMatcher, error) {
+	var matchers []nameMatcher
+	for _, pattern := range patterns {
+		m, err := parseNameMatcher(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
+
+func matchesAny(matchers []nameMatcher, name string) bool {
+	for _, m := range matchers {
+		if m(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterParameters keeps the parameters whose full name matches one of the
+// --include patterns, all if there are none, and none of the --exclude
+// patterns.
+func filterParameters(c *cli.Context, parameters []resolvedParameter) ([]resolvedParameter, error) {
+	include, err := parseNameMatchers(c.GlobalStringSlice("include"))
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := parseNameMatchers(c.GlobalStringSlice("exclude"))
+	if err != nil {
+		return nil, err
+	}
+	if len(include) == 0 && len(exclude) == 0 {
+		return parameters, nil
+	}
+
+	filtered := parameters[:0]
+	for _, p := range parameters {
+		if (len(include) > 0 && !matchesAny(include, *p.Name)) || matchesAny(exclude, *p.Name) {
+			log.WithField("name", *p.Name).Debug("parameter filtered out")
+			continue
+		}
+		filtered = append(filtered, p)
+	}
+	return filtered, nil
+}
+
+// parseTagFilters turns the --tag-filter KEY=VALUE[,VALUE...] arguments into
+// filters that only let parameters with one of the values of every tag pass.
+func parseTagFilters(args []string) ([]types.ParameterStringFilter, error) {
+	var filters []types.ParameterStringFilter
+	for _, arg := range args {
+		pair := strings.SplitN(arg, "=", 2)
+		if len(pair) != 2 || pair[0] == "" || pair[1] == "" {
+			return nil, fmt.Errorf("invalid tag-filter %q, expected KEY=VALUE", arg)
+		}
+		filters = append(filters, types.ParameterStringFilter{
+			Key:    aws.String("tag:" + pair[0]),
+			Option: aws.String("Equals"),
+			Values: strings.Split(pair[1], ","),
+		})
+	}
+	return filters, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// watchHealth runs --health-command periodically while the command runs. The
+// returned channel receives a value once the health command failed
+// --health-retries times in a row, the returned func stops the checks.
+func watchHealth(c *cli.Context) (<-chan struct{}, func()) {
+	script := c.GlobalString("health-command")
+	if script == "" {
+		return nil, func() {}
+	}
+	interval := c.GlobalDuration("health-interval")
+	retries := c.GlobalInt("health-retries")
+
+	unhealthyCh := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		timer := time.NewTimer(c.GlobalDuration("health-start-period"))
+		defer timer.Stop()
+
+		healthy := false
+		failures := 0
+		for {
+			select {
+			case <-done:
+				return
+			case <-timer.C:
+			}
+
+			if err := runHealthCheck(script, interval); err != nil {
+				failures++
+				entry := log.WithError(err).WithField("failures", failures)
+				if healthy {
+					entry.Warn("command became unhealthy")
+				} else {
+					entry.Warn("health check failed")
+				}
+				healthy = false
+				if failures >= retries {
+					unhealthyCh <- struct{}{}
+					return
+				}
+			} else {
+				if !healthy {
+					log.Info("command is healthy")
+				}
+				healthy = true
+				failures = 0
+			}
+			timer.Reset(interval)
+		}
+	}()
+
+	return unhealthyCh, func() { close(done) }
+}
+
+func runHealthCheck(script string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	shell, args := shellCommand(script)
+	output, err := exec.CommandContext(ctx, shell, args...).CombinedOutput()
+	if out := strings.TrimSpace(string(output)); out != "" {
+		log.WithField("output", out).Debug("health command output")
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
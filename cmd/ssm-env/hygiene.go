@@ -0,0 +1,59 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// plaintextDuplicate is a SecureString whose value is also stored in a plain
+// String or StringList parameter
+type plaintextDuplicate struct {
+	Secure    string
+	Plaintext string
+}
+
+// findPlaintextDuplicates compares the values of all fetched SSM parameters
+// and returns every pair of a SecureString and a plaintext parameter holding
+// the same value.
+func findPlaintextDuplicates(parameters []resolvedParameter) []plaintextDuplicate {
+	secure := map[string][]string{}
+	plain := map[string][]string{}
+	seen := map[string]bool{}
+	for _, p := range parameters {
+		if p.Source != sourceSSM || *p.Value == "" || seen[*p.Name] {
+			continue
+		}
+		seen[*p.Name] = true
+		if p.Type == types.ParameterTypeSecureString {
+			secure[*p.Value] = append(secure[*p.Value], *p.Name)
+		} else {
+			plain[*p.Value] = append(plain[*p.Value], *p.Name)
+		}
+	}
+
+	var duplicates []plaintextDuplicate
+	for value, secureNames := range secure {
+		for _, secureName := range secureNames {
+			for _, plainName := range plain[value] {
+				duplicates = append(duplicates, plaintextDuplicate{Secure: secureName, Plaintext: plainName})
+			}
+		}
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		if duplicates[i].Secure != duplicates[j].Secure {
+			return duplicates[i].Secure < duplicates[j].Secure
+		}
+		return duplicates[i].Plaintext < duplicates[j].Plaintext
+	})
+	return duplicates
+}
+
+// warnPlaintextSecrets logs the names of SecureStrings whose values are also
+// stored in plaintext parameters. Values are never logged.
+func warnPlaintextSecrets(parameters []resolvedParameter) {
+	for _, d := range findPlaintextDuplicates(parameters) {
+		log.WithField("secure", d.Secure).WithField("plaintext", d.Plaintext).Warn("secret may be exposed as a plaintext parameter")
+	}
+}
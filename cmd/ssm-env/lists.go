@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// mergeLists replaces the value of every StringList parameter that wins for
+// its env name with the items of all StringList parameters of that name, in
+// the order they were fetched and with duplicates removed. Lists that are
+// overridden by a plain String are left alone.
+func mergeLists(parameters []resolvedParameter) {
+	winners := map[string]int{}
+	for i, p := range parameters {
+		winners[p.EnvName] = i
+	}
+
+	items := map[string][]string{}
+	sources := map[string]int{}
+	for _, p := range parameters {
+		if p.Type == types.ParameterTypeStringList {
+			items[p.EnvName] = append(items[p.EnvName], splitStringList(*p.Value)...)
+			sources[p.EnvName]++
+		}
+	}
+
+	for name, i := range winners {
+		if parameters[i].Type != types.ParameterTypeStringList || sources[name] < 2 {
+			continue
+		}
+		var merged []string
+		seen := map[string]bool{}
+		for _, item := range items[name] {
+			if !seen[item] {
+				seen[item] = true
+				merged = append(merged, item)
+			}
+		}
+		parameters[i].Value = aws.String(joinStringList(merged))
+		log.WithField("name", name).WithField("lists", sources[name]).Debug("merged StringList parameters")
+	}
+}
+
+// splitStringList splits a StringList value at its commas. A comma escaped
+// with a backslash is kept as part of the item.
+func splitStringList(value string) []string {
+	var items []string
+	var item strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value) && value[i+1] == ',':
+			item.WriteByte(',')
+			i++
+		case value[i] == ',':
+			items = append(items, item.String())
+			item.Reset()
+		default:
+			item.WriteByte(value[i])
+		}
+	}
+	return append(items, item.String())
+}
+
+// joinStringList joins items to a StringList value, escaping the commas
+// within the items like splitStringList expects them.
+func joinStringList(items []string) string {
+	escaped := make([]string, len(items))
+	for i, item := range items {
+		escaped[i] = strings.ReplaceAll(item, ",", `\,`)
+	}
+	return strings.Join(escaped, ",")
+}
+
+// expandStringLists replaces every StringList parameter that wins for its env
+// name KEY with one parameter KEY_0, KEY_1, ... per item and KEY_COUNT
+// holding the number of items. The parameters it overrides are dropped, as
+// KEY itself is no longer set.
+func expandStringLists(parameters []resolvedParameter) []resolvedParameter {
+	winners := map[string]int{}
+	for i, p := range parameters {
+		winners[p.EnvName] = i
+	}
+
+	expanded := make([]resolvedParameter, 0, len(parameters))
+	for i, p := range parameters {
+		winner := parameters[winners[p.EnvName]]
+		if winner.Type != types.ParameterTypeStringList {
+			expanded = append(expanded, p)
+			continue
+		}
+		if winners[p.EnvName] != i {
+			continue
+		}
+
+		items := splitStringList(*p.Value)
+		for n, item := range items {
+			entry := p
+			entry.EnvName = fmt.Sprintf("%s_%d", p.EnvName, n)
+			entry.Value = aws.String(item)
+			expanded = append(expanded, entry)
+		}
+		count := p
+		count.EnvName = p.EnvName + "_COUNT"
+		count.Value = aws.String(strconv.Itoa(len(items)))
+		expanded = append(expanded, count)
+		log.WithField("name", p.EnvName).WithField("items", len(items)).Debug("expanded StringList parameter")
+	}
+	return expanded
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+func TestMergeLists(t *testing.T) {
+	list := func(name, value string) resolvedParameter {
+		return resolvedParameter{Parameter: types.Parameter{Name: aws.String(name), Type: types.ParameterTypeStringList, Value: aws.String(value)}, EnvName: "HOSTS"}
+	}
+	parameters := []resolvedParameter{
+		list("/common/HOSTS", `a,b\,c,d`),
+		list("/app/HOSTS", `d,e\,f,b\,c`),
+	}
+	mergeLists(parameters)
+
+	want := `a,b\,c,d,e\,f`
+	if got := *parameters[1].Value; got != want {
+		t.Errorf("merged list %s, want %s", got, want)
+	}
+	if got, want := splitStringList(*parameters[1].Value), []string{"a", "b,c", "d", "e,f"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("merged items %q, want %q", got, want)
+	}
+}
+
+func TestSplitStringList(t *testing.T) {
+	tests := map[string][]string{
+		"":       {""},
+		"a":      {"a"},
+		"a,b":    {"a", "b"},
+		`a\,b,c`: {"a,b", "c"},
+		`a,,b`:   {"a", "", "b"},
+		`a\b,c\`: {`a\b`, `c\`},
+		`\,\,`:   {",,"},
+	}
+	for value, want := range tests {
+		if got := splitStringList(value); !reflect.DeepEqual(got, want) {
+			t.Errorf("splitStringList(%q) = %q, want %q", value, got, want)
+		}
+		if got := joinStringList(want); got != value {
+			t.Errorf("joinStringList(%q) = %q, want %q", want, got, value)
+		}
+	}
+}
+
+func TestMergedListsDontCollide(t *testing.T) {
+	parameter := func(prefix string, parameterType types.ParameterType) resolvedParameter {
+		return resolvedParameter{
+			Parameter: types.Parameter{Name: aws.String(prefix + "HOSTS"), Type: parameterType, Value: aws.String("a,b")},
+			Prefix:    prefix,
+			EnvName:   "HOSTS",
+		}
+	}
+	tests := []struct {
+		name       string
+		args       []string
+		parameters []resolvedParameter
+		wantErr    bool
+	}{
+		{
+			name:       "merged lists",
+			args:       []string{"--merge-lists"},
+			parameters: []resolvedParameter{parameter("/base/", types.ParameterTypeStringList), parameter("/app/", types.ParameterTypeStringList)},
+		},
+		{
+			name:       "lists without merge-lists",
+			parameters: []resolvedParameter{parameter("/base/", types.ParameterTypeStringList), parameter("/app/", types.ParameterTypeStringList)},
+			wantErr:    true,
+		},
+		{
+			name:       "list overridden by a string",
+			args:       []string{"--merge-lists"},
+			parameters: []resolvedParameter{parameter("/base/", types.ParameterTypeStringList), parameter("/app/", types.ParameterTypeString)},
+			wantErr:    true,
+		},
+		{
+			name:       "string overridden by a list",
+			args:       []string{"--merge-lists"},
+			parameters: []resolvedParameter{parameter("/base/", types.ParameterTypeString), parameter("/app/", types.ParameterTypeStringList)},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestContext(t, append(tt.args, "--fail-on-collision")...)
+			if err := checkCollisions(c, tt.parameters); (err != nil) != tt.wantErr {
+				t.Errorf("checkCollisions() error = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -3,31 +3,48 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path"
 	"regexp"
+	"runtime"
+	"sync"
 	"syscall"
+	"time"
 
 	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
+	"golang.org/x/sync/errgroup"
 )
 
 var VersionString string
 var procfileRegex = regexp.MustCompile(`^([A-Za-z0-9_\-]+):\s*(.+)$`)
 
 const (
-	AppRunError        = -(iota)
-	RunCommandError    = -(iota)
-	ValidateArgsError  = -(iota)
-	GetParametersError = -(iota)
+	AppRunError         = -(iota)
+	RunCommandError     = -(iota)
+	ValidateArgsError   = -(iota)
+	GetParametersError  = -(iota)
+	PushParametersError = -(iota)
+	WriteOutputError    = -(iota)
+	ConfigChangedError  = -(iota)
+	AuditError          = -(iota)
 )
 
 func main() {
@@ -39,142 +56,1389 @@ func main() {
 	app.Name = "ssm-env"
 	app.Usage = "Application entry-point that injects SSM Parameter Store values as Environment Variables"
 	app.UsageText = "ssm-env [global options] -p prefix command [command arguments]"
-	app.Version = VersionString
+	app.Version = version()
+	cli.VersionPrinter = printVersion
 	app.Flags = cliFlags()
+	app.Commands = []cli.Command{
+		pushCommand(),
+		dumpCommand(),
+		auditCommand(),
+	}
+	app.Before = func(c *cli.Context) error {
+		if err := loadConfigFile(c); err != nil {
+			return failure(c, "load config file", err, ValidateArgsError)
+		}
+		return nil
+	}
 	app.Action = func(c *cli.Context) error {
 		return action(c)
 	}
-	if err := app.Run(os.Args); err != nil {
-		_ = cli.NewExitError(errorPrefix(err), AppRunError)
+	// exit codes are handled below instead of by the cli package
+	app.ExitErrHandler = func(*cli.Context, error) {}
+	os.Exit(exitCode(app.Run(os.Args)))
+}
+
+// exitCode prints err and returns the code ssm-env exits with: the code of
+// an exit error, which for a failed command is the command's own exit code,
+// or 1 for any other error. Failures of the command are not printed.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	// the failure of the command was logged already
+	var commandErr commandExitError
+	if errors.As(err, &commandErr) {
+		return commandErr.ExitCode()
+	}
+	if coder, ok := err.(cli.ExitCoder); ok {
+		if message := err.Error(); message != "" {
+			printError(message)
+		}
+		return coder.ExitCode()
+	}
+	printError(errorPrefix(err))
+	return 1
+}
+
+// printError prints the message of a failure to stderr, as a log entry when
+// the logs are JSON so log pipelines can parse it.
+func printError(message string) {
+	if _, ok := log.StandardLogger().Formatter.(*log.JSONFormatter); !ok {
+		fmt.Fprintln(cli.ErrWriter, message)
+		return
+	}
+	logger := &log.Logger{
+		Out:       cli.ErrWriter,
+		Formatter: log.StandardLogger().Formatter,
+		Hooks:     log.StandardLogger().Hooks,
+		Level:     log.ErrorLevel,
+	}
+	logger.Error(strings.TrimPrefix(message, "ERROR: "))
+}
+
+func configureLogging(c *cli.Context) error {
+	switch format := c.GlobalString("log-format"); format {
+	case "text":
+	case "json":
+		log.SetFormatter(&log.JSONFormatter{})
+	default:
+		return fmt.Errorf("invalid log format %q, expected text or json", format)
+	}
+	if levelName := c.GlobalString("log-level"); levelName != "" {
+		level, err := log.ParseLevel(levelName)
+		if err != nil {
+			return err
+		}
+		log.SetLevel(level)
+	} else if c.GlobalBool("debug") {
+		log.SetLevel(log.DebugLevel)
+	}
+	switch {
+	case c.GlobalBool("silent"):
+		log.SetOutput(ioutil.Discard)
+	case c.GlobalBool("export"), c.GlobalBool("dry-run"):
+		// stdout is reserved for the export statements or the table
+		log.SetOutput(os.Stderr)
+	default:
+		log.SetOutput(os.Stdout)
+	}
+	configureMasking(c)
+	return nil
+}
+
+func action(c *cli.Context) error {
+	if err := configureLogging(c); err != nil {
+		return failure(c, "configure logging", err, ValidateArgsError)
+	}
+
+	if name := c.GlobalString("bootstrap"); name != "" {
+		spec, err := fetchLaunchSpec(context.TODO(), c, name)
+		if err != nil {
+			return failure(c, "bootstrap", fmt.Errorf("bootstrap %s: %w", name, err), ValidateArgsError)
+		}
+		if err := applyLaunchSpec(c, spec); err != nil {
+			return failure(c, "bootstrap", err, ValidateArgsError)
+		}
+	}
+
+	if err := validateArgs(c); err != nil {
+		return failure(c, "validate options", err, ValidateArgsError)
+	}
+
+	// a dry run only shows the mapping, nothing is set or run
+	if c.GlobalBool("dry-run") {
+		parameters, err := fetchParameters(context.TODO(), c)
+		if err != nil {
+			return failure(c, "fetch parameters", err, GetParametersError)
+		}
+		if err := checkCollisions(c, parameters); err != nil {
+			return failure(c, "fetch parameters", err, GetParametersError)
+		}
+		if c.GlobalBool("stringlist-expand") {
+			parameters = expandStringLists(parameters)
+		}
+		if _, err := os.Stdout.WriteString(formatDryRun(parameters)); err != nil {
+			return failure(c, "write dry run", err, WriteOutputError)
+		}
+		return nil
+	}
+
+	// inject the run id and metadata first so parameters can reference them
+	if err := injectRunID(c); err != nil {
+		return failure(c, "generate run id", err, ValidateArgsError)
+	}
+	if c.GlobalBool("ecs-metadata") {
+		if err := injectECSMetadata(context.TODO()); err != nil {
+			return failure(c, "read ecs metadata", err, GetParametersError)
+		}
+	}
+
+	var parameters []resolvedParameter
+	if !c.GlobalBool("test") {
+		if socketPath := c.GlobalString("agent-socket"); socketPath != "" {
+			agent, err := startAgent(c, socketPath)
+			if err != nil {
+				return failure(c, "fetch parameters", err, GetParametersError)
+			}
+			defer agent.Close()
+		} else {
+			var err error
+			if parameters, err = getParameters(c); err != nil {
+				return failure(c, "fetch parameters", err, GetParametersError)
+			}
+		}
+	}
+
+	if err := checkSnapshots(c, parameters); err != nil {
+		return failure(c, "check snapshot", err, GetParametersError)
+	}
+
+	if file := c.GlobalString("since"); file != "" {
+		changed, err := changedSince(c, parameters)
+		if err != nil {
+			return failure(c, "check snapshot", err, GetParametersError)
+		}
+		if changed {
+			return cli.NewExitError(errorPrefix(fmt.Errorf("config changed since %s", file)), ConfigChangedError)
+		}
+		log.WithField("snapshot", file).Info("config unchanged")
+		return nil
+	}
+
+	if err := validateValues(c); err != nil {
+		return failure(c, "validate values", err, ValidateArgsError)
+	}
+
+	if file := c.GlobalString("dump-env"); file != "" {
+		if err := writeDotenvFile(file, parameters); err != nil {
+			return failure(c, "write dotenv file", err, WriteOutputError)
+		}
+		return nil
+	}
+
+	if err := emitDotenvVar(c, parameters); err != nil {
+		return failure(c, "set env vars", err, GetParametersError)
+	}
+
+	offloadDir, err := offloadLargeValues(c, parameters)
+	if offloadDir != "" {
+		defer os.RemoveAll(offloadDir)
+	}
+	if err != nil {
+		return failure(c, "offload values", err, GetParametersError)
+	}
+
+	if c.GlobalBool("export") {
+		if _, err := os.Stdout.WriteString(formatExports(resolvedVars(parameters))); err != nil {
+			return failure(c, "write exports", err, WriteOutputError)
+		}
+		return nil
+	}
+
+	if fd := c.GlobalInt("write-fd"); fd > 0 {
+		if err := writeExportsToFD(fd, parameters); err != nil {
+			return failure(c, "write exports", err, WriteOutputError)
+		}
+		return nil
+	}
+
+	if err := renderTemplates(c, parameters); err != nil {
+		return failure(c, "render templates", err, WriteOutputError)
+	}
+
+	err = runCommand(c)
+	// the command's own failures are passed on as they are
+	var exitErr *exec.ExitError
+	if err != nil && c.GlobalBool("verbose-errors") && !errors.As(err, &exitErr) {
+		code := RunCommandError
+		if coder, ok := err.(cli.ExitCoder); ok {
+			code = coder.ExitCode()
+		}
+		return failure(c, "run command", err, code)
+	}
+	return err
+}
+
+func cliFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "YAML file setting global options, which options given on the command line override",
+			EnvVar: "SSM_ENV_CONFIG",
+		},
+		cli.StringSliceFlag{
+			Name:   "prefix, p",
+			Usage:  "Key prefix that is used to retrieve the environment variables - supports multiple use",
+			EnvVar: "PARAMS_PREFIX",
+		},
+		cli.StringFlag{
+			Name:   "assume-role-arn",
+			Usage:  "ARN of a role to assume with the ambient credentials, whose credentials are used for all AWS requests",
+			EnvVar: "ASSUME_ROLE_ARN",
+		},
+		cli.StringFlag{
+			Name:   "assume-role-session-name",
+			Value:  "ssm-env",
+			Usage:  "Session name of the assumed role",
+			EnvVar: "ASSUME_ROLE_SESSION_NAME",
+		},
+		cli.StringFlag{
+			Name:   "external-id",
+			Usage:  "External ID passed when assuming the role, for roles of third parties",
+			EnvVar: "ASSUME_ROLE_EXTERNAL_ID",
+		},
+		cli.StringFlag{
+			Name:   "cache-file",
+			Usage:  "File to cache the fetched parameters in, to skip fetching them while the cache is fresher than --cache-ttl",
+			EnvVar: "SSM_ENV_CACHE_FILE",
+		},
+		cli.DurationFlag{
+			Name:   "cache-ttl",
+			Usage:  "How long the parameters in --cache-file are used before they are fetched again",
+			EnvVar: "SSM_ENV_CACHE_TTL",
+		},
+		cli.BoolFlag{
+			Name:  "refresh-cache",
+			Usage: "Fetch the parameters and update --cache-file even if the cache is fresh",
+		},
+		cli.StringFlag{
+			Name:  "region",
+			Usage: "AWS region to use instead of the one of the environment or profile",
+		},
+		cli.StringFlag{
+			Name:   "ssm-endpoint-url",
+			Usage:  "Endpoint URL of SSM and Secrets Manager, e.g. of LocalStack, instead of the AWS endpoints",
+			EnvVar: "SSM_ENDPOINT_URL",
+		},
+		cli.BoolFlag{
+			Name:   "use-fips",
+			Usage:  "Use the FIPS endpoints of the AWS services",
+			EnvVar: "USE_FIPS",
+		},
+		cli.StringFlag{
+			Name:   "bootstrap",
+			Usage:  "Parameter holding a JSON launch spec with the prefixes, naming options and command to run",
+			EnvVar: "SSM_ENV_BOOTSTRAP",
+		},
+		cli.StringFlag{
+			Name:   "common-prefix",
+			Usage:  "Key prefix that is always fetched first, so the -p prefixes override its values",
+			EnvVar: "COMMON_PREFIX",
+		},
+		cli.BoolFlag{
+			Name:   "debug",
+			Usage:  "Log additional debugging information",
+			EnvVar: "PARAMS_DEBUG",
+		},
+		cli.StringSliceFlag{
+			Name:   "param, k",
+			Usage:  "Fully qualified name of a single parameter to load, fetched after the prefixes - supports multiple use",
+			EnvVar: "PARAMS_NAME",
+		},
+		cli.BoolFlag{
+			Name:   "ignore-missing",
+			Usage:  "Skip --param parameters that don't exist instead of failing",
+			EnvVar: "IGNORE_MISSING",
+		},
+		cli.StringSliceFlag{
+			Name:   "name-transform",
+			Usage:  "sed-like s/pattern/replacement/ expression applied to the env names, applied in order - supports multiple use",
+			EnvVar: "NAME_TRANSFORM",
+		},
+		cli.BoolFlag{
+			Name:   "upcase",
+			Usage:  "Uppercase the env names and replace every character that is not a letter or digit with an underscore",
+			EnvVar: "UPCASE",
+		},
+		cli.BoolFlag{
+			Name:  "create-missing-prefix",
+			Usage: "Development only, never use in production: create a placeholder parameter in prefixes without parameters, requires --confirm",
+		},
+		cli.BoolFlag{
+			Name:   "require-params",
+			Usage:  "Fail when a prefix has no parameters instead of only warning",
+			EnvVar: "REQUIRE_PARAMS",
+		},
+		cli.IntFlag{
+			Name:   "min-params",
+			Usage:  "Fail when a prefix has fewer parameters than this",
+			EnvVar: "MIN_PARAMS",
+		},
+		cli.BoolFlag{
+			Name:  "confirm",
+			Usage: "Confirm writing to SSM for --create-missing-prefix, without it nothing is written",
+		},
+		cli.BoolFlag{
+			Name:   "resolve-ssm-refs",
+			Usage:  "Replace values of the form ssm:///path with the value of the referenced parameter",
+			EnvVar: "RESOLVE_SSM_REFS",
+		},
+		cli.BoolFlag{
+			Name:   "ssm-refs-cross-region",
+			Usage:  "Allow references of the form ssm://region//path to parameters in other regions, requires --resolve-ssm-refs",
+			EnvVar: "SSM_REFS_CROSS_REGION",
+		},
+		cli.BoolFlag{
+			Name:  "unmask",
+			Usage: "Show parameter values in logs and output instead of masking them, for local debugging only",
+		},
+		cli.BoolFlag{
+			Name:   "fail-on-collision",
+			Usage:  "Fail when parameters of different prefixes map to the same env var instead of warning",
+			EnvVar: "FAIL_ON_COLLISION",
+		},
+		cli.BoolFlag{
+			Name:   "strict-names",
+			Usage:  "Fail on env names that are not valid shell identifiers instead of sanitizing them",
+			EnvVar: "STRICT_NAMES",
+		},
+		cli.StringFlag{
+			Name:   "log-level",
+			Usage:  "Log level (trace|debug|info|warn|error), takes precedence over --debug",
+			EnvVar: "LOG_LEVEL",
+		},
+		cli.StringFlag{
+			Name:   "log-format",
+			Value:  "text",
+			Usage:  "Format of the logs and startup errors (text|json)",
+			EnvVar: "LOG_FORMAT",
+		},
+		cli.BoolFlag{
+			Name:   "silent",
+			Usage:  "Silence all logs",
+			EnvVar: "PARAMS_SILENT",
+		},
+		cli.BoolFlag{
+			Name:   "long-env-name",
+			Usage:  "Use full key path as env name",
+			EnvVar: "LONG_ENV_NAME",
+		},
+		cli.StringSliceFlag{
+			Name:   "procfile",
+			Usage:  "Path to procfile to use - supports multiple use, later files override entries of earlier ones",
+			EnvVar: "PROCFILE",
+		},
+		cli.BoolFlag{
+			Name:   "test",
+			Usage:  "When running in test mode ssm-env will only launch the target app and will not attempt to read env from SSM",
+			EnvVar: "SSM_ENV_TEST",
+		},
+		cli.BoolFlag{
+			Name:   "stringlist-expand",
+			Usage:  "Set StringList parameters as KEY_0, KEY_1, ... and KEY_COUNT instead of a single comma separated KEY",
+			EnvVar: "STRINGLIST_EXPAND",
+		},
+		cli.BoolFlag{
+			Name:   "merge-lists",
+			Usage:  "Combine StringList parameters with the same env name from different prefixes instead of letting the last one win",
+			EnvVar: "MERGE_LISTS",
+		},
+		cli.BoolFlag{
+			Name:   "no-overwrite",
+			Usage:  "Only set env vars that are not already set in the environment of ssm-env, so existing values win over SSM",
+			EnvVar: "NO_OVERWRITE",
+		},
+		cli.BoolFlag{
+			Name:   "no-expand",
+			Usage:  "ssm-env will not expand environment variables, to expand env VALUE must start from dollar ($) sign, for example HOME=$USER or HOME=${USER}",
+			EnvVar: "NO_EXPAND",
+		},
+		cli.BoolFlag{
+			Name:   "tty",
+			Usage:  "Allocate a pseudo-terminal for the command and proxy it to ssm-env's stdio",
+			EnvVar: "SSM_ENV_TTY",
+		},
+		cli.BoolFlag{
+			Name:   "all",
+			Usage:  "Run every Procfile entry concurrently with their output prefixed by the entry name, stopping all of them once one exits",
+			EnvVar: "SSM_ENV_ALL",
+		},
+		cli.StringFlag{
+			Name:   "forward-signals",
+			Usage:  "Comma separated signals to forward to the command in addition to HUP, INT, QUIT, ABRT and TERM, e.g. USR1,USR2,WINCH",
+			EnvVar: "FORWARD_SIGNALS",
+		},
+		cli.DurationFlag{
+			Name:   "shutdown-timeout",
+			Usage:  "Kill the command if it hasn't exited this long after the first SIGTERM or SIGINT was forwarded to it, 0 waits forever",
+			EnvVar: "SHUTDOWN_TIMEOUT",
+		},
+		cli.IntFlag{
+			Name:   "oom-exit-code",
+			Usage:  "Exit with this code when the command was killed by the OOM killer (default is to return the command error)",
+			EnvVar: "OOM_EXIT_CODE",
+		},
+		cli.StringFlag{
+			Name:   "unknown-command",
+			Value:  "exec",
+			Usage:  "What to do when the command is not a Procfile entry: exec it as a binary, run it via the shell, or fail with an error (exec|shell|error)",
+			EnvVar: "UNKNOWN_COMMAND",
+		},
+		cli.StringFlag{
+			Name:   "agent-socket",
+			Usage:  "Serve parameters over this unix socket instead of injecting them into the command environment",
+			EnvVar: "AGENT_SOCKET",
+		},
+		cli.DurationFlag{
+			Name:   "agent-refresh",
+			Value:  5 * time.Minute,
+			Usage:  "How often the agent re-fetches parameters, 0 disables refreshing",
+			EnvVar: "AGENT_REFRESH",
+		},
+		cli.StringSliceFlag{
+			Name:   "gzip-decode",
+			Usage:  "Env name whose value is base64 encoded gzip data and is decompressed before injection - supports multiple use",
+			EnvVar: "GZIP_DECODE",
+		},
+		cli.StringFlag{
+			Name:   "health-command",
+			Usage:  "Shell command run periodically to check the health of the command, which is restarted after repeated failures",
+			EnvVar: "HEALTH_COMMAND",
+		},
+		cli.DurationFlag{
+			Name:   "health-interval",
+			Value:  10 * time.Second,
+			Usage:  "Interval (and timeout) of the health command",
+			EnvVar: "HEALTH_INTERVAL",
+		},
+		cli.DurationFlag{
+			Name:   "health-start-period",
+			Value:  10 * time.Second,
+			Usage:  "Time to wait after (re)starting the command before running the first health check",
+			EnvVar: "HEALTH_START_PERIOD",
+		},
+		cli.IntFlag{
+			Name:   "health-retries",
+			Value:  3,
+			Usage:  "Number of consecutive failed health checks after which the command is restarted",
+			EnvVar: "HEALTH_RETRIES",
+		},
+		cli.DurationFlag{
+			Name:   "restart-backoff",
+			Value:  time.Second,
+			Usage:  "Delay before restarting an unhealthy command, doubled for every restart within the restart window",
+			EnvVar: "RESTART_BACKOFF",
+		},
+		cli.DurationFlag{
+			Name:   "restart-backoff-max",
+			Value:  time.Minute,
+			Usage:  "Maximum delay before restarting an unhealthy command",
+			EnvVar: "RESTART_BACKOFF_MAX",
+		},
+		cli.IntFlag{
+			Name:   "max-restarts",
+			Usage:  "Give up and exit with an error once the command was restarted more often within the restart window, 0 restarts forever",
+			EnvVar: "MAX_RESTARTS",
+		},
+		cli.DurationFlag{
+			Name:   "restart-window",
+			Value:  5 * time.Minute,
+			Usage:  "Time window for the restart backoff and max-restarts",
+			EnvVar: "RESTART_WINDOW",
+		},
+		cli.BoolFlag{
+			Name:   "secrets-via-memfd",
+			Usage:  "Pass SecureString parameters to the command through an in-memory file instead of its environment (linux only)",
+			EnvVar: "SECRETS_VIA_MEMFD",
+		},
+		cli.StringSliceFlag{
+			Name:   "expand-only",
+			Usage:  "Only expand references in the values of these env vars and keep all other values literal - supports multiple use",
+			EnvVar: "EXPAND_ONLY",
+		},
+		cli.BoolFlag{
+			Name:   "expand-args",
+			Usage:  "Expand $VAR and ${VAR} references in the command arguments with the resolved environment",
+			EnvVar: "EXPAND_ARGS",
+		},
+		cli.StringSliceFlag{
+			Name:   "secrets-prefix",
+			Usage:  "Name prefix of AWS Secrets Manager secrets that are injected as env vars - supports multiple use",
+			EnvVar: "SECRETS_PREFIX",
+		},
+		cli.BoolFlag{
+			Name:   "secrets-json-expand",
+			Usage:  "Inject every top-level key of a Secrets Manager secret holding a JSON object as its own env var",
+			EnvVar: "SECRETS_JSON_EXPAND",
+		},
+		cli.StringSliceFlag{
+			Name:   "vault-path",
+			Usage:  "Vault KV secret (<mount>/<path>) whose keys are injected as env vars, using VAULT_ADDR and VAULT_TOKEN - supports multiple use",
+			EnvVar: "VAULT_PATH",
+		},
+		cli.IntFlag{
+			Name:   "vault-kv-version",
+			Value:  2,
+			Usage:  "Version of the Vault KV secrets engine (1|2)",
+			EnvVar: "VAULT_KV_VERSION",
+		},
+		cli.StringSliceFlag{
+			Name:   "as-flag",
+			Usage:  "Append the value of an env var to the command arguments as a flag, e.g. DB_HOST=--db-host - supports multiple use",
+			EnvVar: "AS_FLAG",
+		},
+		cli.StringFlag{
+			Name:   "canary-prefix",
+			Usage:  "Prefix with the canary configuration, applied on top of the other prefixes instead of baseline-prefix when its changes are within canary-max-changes",
+			EnvVar: "CANARY_PREFIX",
+		},
+		cli.StringFlag{
+			Name:   "baseline-prefix",
+			Usage:  "Prefix with the stable configuration the canary is compared against",
+			EnvVar: "BASELINE_PREFIX",
+		},
+		cli.IntFlag{
+			Name:   "canary-max-changes",
+			Value:  -1,
+			Usage:  "Maximum number of added, removed or changed variables for the canary to be applied, -1 always applies it",
+			EnvVar: "CANARY_MAX_CHANGES",
+		},
+		cli.IntFlag{
+			Name:   "concurrency",
+			Value:  4,
+			Usage:  "Maximum number of prefixes fetched at the same time",
+			EnvVar: "CONCURRENCY",
+		},
+		cli.DurationFlag{
+			Name:   "fetch-timeout",
+			Usage:  "Timeout for fetching all parameters, 0 disables it",
+			EnvVar: "FETCH_TIMEOUT",
+		},
+		cli.DurationFlag{
+			Name:   "prefix-timeout",
+			Usage:  "Timeout for fetching a single prefix, defaults to its share of --fetch-timeout",
+			EnvVar: "PREFIX_TIMEOUT",
+		},
+		cli.BoolFlag{
+			Name:   "report-all-errors",
+			Usage:  "Attempt every prefix and report the errors of all failed prefixes instead of stopping at the first one",
+			EnvVar: "REPORT_ALL_ERRORS",
+		},
+		cli.IntFlag{
+			Name:   "write-fd",
+			Usage:  "Write the resolved parameters as shell export statements to this file descriptor and exit instead of running a command",
+			EnvVar: "WRITE_FD",
+		},
+		cli.BoolFlag{
+			Name:   "dry-run",
+			Usage:  "Fetch the parameters and print which env names they map to with masked values, without setting anything or running the command",
+			EnvVar: "SSM_ENV_DRY_RUN",
+		},
+		cli.BoolFlag{
+			Name:   "export",
+			Usage:  "Print the resolved parameters as shell export statements to stdout and exit instead of running a command, logging goes to stderr",
+			EnvVar: "SSM_ENV_EXPORT",
+		},
+		cli.StringSliceFlag{
+			Name:   "render",
+			Usage:  "Render a text/template with the parameters as .Env to a file before running the command, given as template:destination - supports multiple use",
+			EnvVar: "RENDER",
+		},
+		cli.StringFlag{
+			Name:   "dump-env",
+			Usage:  "Write the resolved parameters as a dotenv file to this path and exit instead of running a command",
+			EnvVar: "DUMP_ENV",
+		},
+		cli.BoolFlag{
+			Name:   "ecs-metadata",
+			Usage:  "Inject ECS task metadata (ECS_TASK_ARN, ECS_CONTAINER_NAME, ...) as env vars when running on ECS",
+			EnvVar: "ECS_METADATA",
+		},
+		cli.StringSliceFlag{
+			Name:   "validate",
+			Usage:  "Fail unless the resolved value of KEY matches, given as KEY=regex or KEY=int|bool|url|nonempty - supports multiple use",
+			EnvVar: "VALIDATE",
+		},
+		cli.BoolFlag{
+			Name:   "verify-consistency",
+			Usage:  "Re-check the versions of all fetched parameters after fetching and warn about parameters that changed in the meantime",
+			EnvVar: "VERIFY_CONSISTENCY",
+		},
+		cli.BoolFlag{
+			Name:   "detect-plaintext-secrets",
+			Usage:  "Warn when the value of a SecureString parameter is also stored in a plain String parameter",
+			EnvVar: "DETECT_PLAINTEXT_SECRETS",
+		},
+		cli.IntFlag{
+			Name:   "auto-offload-threshold",
+			Usage:  "Maximum environment size in bytes, the largest parameter values are moved to files (exposed as NAME_FILE) until it fits, 0 disables offloading",
+			EnvVar: "AUTO_OFFLOAD_THRESHOLD",
+		},
+		cli.StringFlag{
+			Name:   "offload-dir",
+			Usage:  "Directory the offloaded values are written to (default is the system temp directory)",
+			EnvVar: "OFFLOAD_DIR",
+		},
+		cli.StringFlag{
+			Name:   "write-snapshot",
+			Usage:  "Write the names and versions of the fetched parameters to this file",
+			EnvVar: "WRITE_SNAPSHOT",
+		},
+		cli.StringFlag{
+			Name:   "pin-snapshot",
+			Usage:  "Snapshot file written by --write-snapshot to compare the fetched parameter versions against",
+			EnvVar: "PIN_SNAPSHOT",
+		},
+		cli.BoolFlag{
+			Name:   "fail-on-drift",
+			Usage:  "Fail instead of warning when the fetched parameters drifted from --pin-snapshot",
+			EnvVar: "FAIL_ON_DRIFT",
+		},
+		cli.StringFlag{
+			Name:   "emit-dotenv-var",
+			Usage:  "Additionally pass all parameters as a single dotenv formatted env var with this name",
+			EnvVar: "EMIT_DOTENV_VAR",
+		},
+		cli.BoolFlag{
+			Name:   "emit-dotenv-only",
+			Usage:  "Only pass the --emit-dotenv-var env var, not the individual parameters",
+			EnvVar: "EMIT_DOTENV_ONLY",
+		},
+		cli.DurationFlag{
+			Name:   "connect-timeout",
+			Usage:  "Timeout for establishing a connection to AWS, 0 keeps the SDK default",
+			EnvVar: "CONNECT_TIMEOUT",
+		},
+		cli.DurationFlag{
+			Name:   "tls-handshake-timeout",
+			Usage:  "Timeout for the TLS handshake with AWS, 0 keeps the SDK default",
+			EnvVar: "TLS_HANDSHAKE_TIMEOUT",
+		},
+		cli.DurationFlag{
+			Name:   "response-header-timeout",
+			Usage:  "Timeout for waiting on the response headers of an AWS request, 0 waits indefinitely",
+			EnvVar: "RESPONSE_HEADER_TIMEOUT",
+		},
+		cli.IntFlag{
+			Name:   "max-retries",
+			Value:  retry.DefaultMaxAttempts - 1,
+			Usage:  "Maximum number of retries of a throttled or failed AWS request",
+			EnvVar: "MAX_RETRIES",
+		},
+		cli.DurationFlag{
+			Name:   "retry-base-delay",
+			Value:  100 * time.Millisecond,
+			Usage:  "Maximum delay before the first retry, doubled for every further retry up to 20s",
+			EnvVar: "RETRY_BASE_DELAY",
+		},
+		cli.StringFlag{
+			Name:   "since",
+			Usage:  "Check mode: exit non-zero without running a command if the config changed since this snapshot file",
+			EnvVar: "SINCE",
+		},
+		cli.BoolFlag{
+			Name:   "update-since",
+			Usage:  "Replace the --since snapshot file with the current config after comparing",
+			EnvVar: "UPDATE_SINCE",
+		},
+		cli.StringFlag{
+			Name:   "debug-signal",
+			Value:  defaultDebugSignal,
+			Usage:  "Signal that makes ssm-env log its state and the masked parameters while the command runs, empty to disable",
+			EnvVar: "DEBUG_SIGNAL",
+		},
+		cli.BoolFlag{
+			Name:   "no-new-privs",
+			Usage:  "Start the command with no_new_privs set so it can't gain privileges through setuid binaries (linux only)",
+			EnvVar: "NO_NEW_PRIVS",
+		},
+		cli.StringSliceFlag{
+			Name:   "include",
+			Usage:  "Only use parameters whose full name matches this glob, or regex when prefixed with re: - supports multiple use",
+			EnvVar: "INCLUDE",
+		},
+		cli.StringSliceFlag{
+			Name:   "exclude",
+			Usage:  "Skip parameters whose full name matches this glob, or regex when prefixed with re: - supports multiple use",
+			EnvVar: "EXCLUDE",
+		},
+		cli.StringSliceFlag{
+			Name:   "tag-filter",
+			Usage:  "Only fetch parameters of the prefixes tagged KEY=VALUE, or with one of KEY=VALUE1,VALUE2 - supports multiple use, all must match",
+			EnvVar: "TAG_FILTER",
+		},
+		cli.BoolFlag{
+			Name:   "recursive",
+			Usage:  "Also fetch the parameters nested below the prefixes, not only their immediate children",
+			EnvVar: "RECURSIVE",
+		},
+		cli.BoolFlag{
+			Name:   "no-decryption",
+			Usage:  "Fetch all parameters without decryption, so SecureString parameters hold their ciphertext and no kms:Decrypt permission is needed",
+			EnvVar: "NO_DECRYPTION",
+		},
+		cli.StringSliceFlag{
+			Name:   "no-decrypt-prefix",
+			Usage:  "Prefix that is fetched without decryption to avoid KMS calls, its SecureString parameters are skipped - supports multiple use",
+			EnvVar: "NO_DECRYPT_PREFIX",
+		},
+		cli.BoolFlag{
+			Name:   "report-param-age",
+			Usage:  "Log the name and age of the least and the most recently modified parameter",
+			EnvVar: "REPORT_PARAM_AGE",
+		},
+		cli.BoolFlag{
+			Name:   "decryption-report",
+			Usage:  "Log how many SecureString parameters were decrypted per prefix",
+			EnvVar: "DECRYPTION_REPORT",
+		},
+		cli.BoolFlag{
+			Name:   "exec",
+			Usage:  "Replace ssm-env with the command instead of running it as a child process",
+			EnvVar: "SSM_ENV_EXEC",
+		},
+		cli.StringFlag{
+			Name:   "run-id-var",
+			Usage:  "Generate a random UUID at startup and pass it to the command in this env var, it is also added to the logs of ssm-env",
+			EnvVar: "RUN_ID_VAR",
+		},
+		cli.BoolFlag{
+			Name:   "verbose-errors",
+			Usage:  "Explain startup failures with the failed phase, AWS error code, prefixes and a suggested fix",
+			EnvVar: "VERBOSE_ERRORS",
+		},
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "Print the version information of --version as JSON",
+		},
+	}
+}
+
+func errorPrefix(err error) string {
+	return strings.Join([]string{"ERROR:", redactSecrets(err.Error())}, " ")
+}
+
+func escapeEnvVar(str string) string {
+	if str == "$" {
+		return "$"
+	}
+
+	return os.Getenv(str)
+}
+
+// resolvedParameter is a parameter fetched from SSM together with the prefix
+// it was fetched from and the env var name it maps to.
+type resolvedParameter struct {
+	types.Parameter
+	Source  string
+	Prefix  string
+	EnvName string
+	// Region of a parameter of a region-qualified prefix, empty for the
+	// default region
+	Region string `json:",omitempty"`
+}
+
+// sources of resolved parameters
+const (
+	sourceSSM            = "ssm"
+	sourceSecretsManager = "secretsmanager"
+	sourceVault          = "vault"
+)
+
+func getParameters(c *cli.Context) ([]resolvedParameter, error) {
+	ctx := context.TODO()
+
+	parameters, err := fetchCachedParameters(ctx, c)
+	if err != nil {
+		// the error is explained by the caller
+		if c.GlobalBool("verbose-errors") {
+			return nil, err
+		}
+		log.Fatalf("error loading SSM params, %v", err)
+		return nil, err
+	}
+	if err := checkCollisions(c, parameters); err != nil {
+		return nil, err
+	}
+	if c.GlobalBool("stringlist-expand") {
+		parameters = expandStringLists(parameters)
+	}
+	viaMemfd := c.GlobalBool("secrets-via-memfd")
+	noOverwrite := c.GlobalBool("no-overwrite")
+	preset := map[string]bool{}
+	for _, e := range os.Environ() {
+		preset[strings.SplitN(e, "=", 2)[0]] = true
+	}
+	var secrets []envVar
+	for _, p := range parameters {
+		if noOverwrite && preset[p.EnvName] {
+			log.WithField("name", p.EnvName).Debug("env var already set, not overwriting it")
+			continue
+		}
+		if viaMemfd && p.Type == types.ParameterTypeSecureString {
+			secrets = append(secrets, envVar{Name: p.EnvName, Value: *p.Value})
+			continue
+		}
+		if err := os.Setenv(p.EnvName, *p.Value); err != nil {
+			return nil, err
+		}
+	}
+	if viaMemfd {
+		if err := shareSecrets(secrets); err != nil {
+			return nil, err
+		}
+	}
+
+	if !c.GlobalBool("no-expand") {
+		environ := map[string]string{}
+		for _, e := range os.Environ() {
+			pair := strings.SplitN(e, "=", 2)
+			environ[pair[0]] = pair[1]
+		}
+		expanded, err := expandAllowed(c, environ, func(string) string { return "" })
+		if err != nil {
+			log.Fatalf("error expanding env params, %v", err)
+			return nil, err
+		}
+		for name, value := range expanded {
+			if value == environ[name] {
+				continue
+			}
+			registerSecrets(value)
+			if err := os.Setenv(name, value); err != nil {
+				log.Fatalf("error setting env params, %v", err)
+				return nil, err
+			}
+		}
+	}
+	return parameters, nil
+}
+
+// fetchParameters loads the parameters of all prefixes in the order the
+// prefixes were given, so later prefixes win when applied in order.
+func fetchParameters(ctx context.Context, c *cli.Context) ([]resolvedParameter, error) {
+	svc, err := newSSMClient(ctx, c)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load SDK config, %v", err)
+	}
+
+	if timeout := c.GlobalDuration("fetch-timeout"); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// prefixes are fetched concurrently, but their results are collected by
+	// position so the precedence doesn't depend on which fetch finishes first
+	all := prefixes(c)
+	results := make([][]resolvedParameter, len(all))
+	prefixErrs := make([]error, len(all))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(c.GlobalInt("concurrency"))
+	for i, prefix := range all {
+		g.Go(func() error {
+			pctx := gctx
+			if timeout := prefixTimeout(c, len(all)); timeout > 0 {
+				var cancel context.CancelFunc
+				pctx, cancel = context.WithTimeout(gctx, timeout)
+				defer cancel()
+			}
+
+			start := time.Now()
+			parameters, err := fetchPrefix(pctx, c, svc, prefix)
+			entry := log.WithField("prefix", prefix).WithField("duration", time.Since(start).Round(time.Millisecond).String())
+			if err != nil {
+				entry.WithError(err).Warn("failed to fetch prefix")
+				if !c.GlobalBool("report-all-errors") {
+					return err
+				}
+				prefixErrs[i] = fmt.Errorf("prefix %s: %w", prefix, err)
+				return nil
+			}
+			entry.WithField("parameters", len(parameters)).Debug("fetched prefix")
+			results[i] = parameters
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	if err := errors.Join(prefixErrs...); err != nil {
+		return nil, err
+	}
+
+	var resolved []resolvedParameter
+	for _, parameters := range results {
+		resolved = append(resolved, parameters...)
+	}
+
+	parameters, err := fetchNamedParameters(ctx, c, svc)
+	if err != nil {
+		return nil, err
+	}
+	resolved = append(resolved, parameters...)
+
+	if c.GlobalString("canary-prefix") != "" {
+		parameters, err := chooseCanary(ctx, c, svc)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, parameters...)
+	}
+
+	managed, err := fetchManagedSecrets(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	resolved = append(resolved, managed...)
+
+	// vault secrets are applied last and take precedence over AWS
+	secrets, err := fetchVaultSecrets(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	resolved = append(resolved, secrets...)
+
+	if resolved, err = filterParameters(c, resolved); err != nil {
+		return nil, err
+	}
+
+	if c.GlobalBool("resolve-ssm-refs") {
+		if err := resolveSSMRefs(ctx, c, resolved); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.GlobalBool("detect-plaintext-secrets") {
+		warnPlaintextSecrets(resolved)
+	}
+
+	if c.GlobalBool("verify-consistency") {
+		if err := verifyConsistency(ctx, c, resolved); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := transformNames(c, resolved); err != nil {
+		return nil, err
+	}
+
+	if c.GlobalBool("merge-lists") {
+		mergeLists(resolved)
+	}
+
+	if err := decodeParameters(c, resolved); err != nil {
+		return nil, err
+	}
+	registerParameterSecrets(resolved)
+	if c.GlobalBool("report-param-age") {
+		reportParameterAge(resolved, time.Now())
+	}
+	state.setParameters(resolved)
+	return resolved, nil
+}
+
+// prefixTimeout returns the timeout of a single prefix fetch: --prefix-timeout,
+// or by default the share of --fetch-timeout left for each round of
+// concurrent fetches.
+func prefixTimeout(c *cli.Context, prefixCount int) time.Duration {
+	if timeout := c.GlobalDuration("prefix-timeout"); timeout > 0 {
+		return timeout
+	}
+	timeout := c.GlobalDuration("fetch-timeout")
+	concurrency := c.GlobalInt("concurrency")
+	rounds := (prefixCount + concurrency - 1) / concurrency
+	if timeout <= 0 || rounds <= 1 {
+		return timeout
+	}
+	return timeout / time.Duration(rounds)
+}
+
+// prefixes returns the prefixes to fetch from lowest to highest precedence:
+// the common prefix followed by the -p prefixes in the order given.
+func prefixes(c *cli.Context) []string {
+	all := c.GlobalStringSlice("prefix")
+	if common := c.GlobalString("common-prefix"); common != "" {
+		all = append([]string{common}, all...)
+	}
+	return all
+}
+
+// fetchPrefix loads the parameters of a single prefix and maps them to env
+// var names.
+func fetchPrefix(ctx context.Context, c *cli.Context, svc *ssm.Client, prefix string) ([]resolvedParameter, error) {
+	longFileName := c.GlobalBool("long-env-name")
+	label, prefix := splitPrefixLabel(prefix)
+	region, prefix := splitRegionPrefix(prefix)
+	prefix = normalizePrefix(prefix)
+	if region != "" {
+		var err error
+		if svc, err = newRegionalSSMClient(ctx, c, region); err != nil {
+			return nil, fmt.Errorf("unable to load SDK config, %v", err)
+		}
+	}
+
+	decrypt := decryptPrefix(c, prefix)
+	// the subcommands don't run validateArgs
+	filters, err := parseTagFilters(c.GlobalStringSlice("tag-filter"))
+	if err != nil {
+		return nil, err
+	}
+	parameters, err := getAllParametersByPath(ctx, svc, prefix, decrypt, c.GlobalBool("recursive"), filters)
+	if err != nil {
+		return nil, err
+	}
+	if len(parameters) == 0 && c.GlobalBool("create-missing-prefix") {
+		if err := createPlaceholder(ctx, c, svc, prefix); err != nil {
+			return nil, fmt.Errorf("creating placeholder for %s: %w", prefix, err)
+		}
+	}
+
+	var resolved []resolvedParameter
+	decrypted := 0
+	for _, v := range parameters {
+		if isPlaceholder(*v.Name) {
+			continue
+		}
+		if v.Type == types.ParameterTypeSecureString {
+			// with --no-decryption the ciphertext is wanted
+			if !decrypt && !c.GlobalBool("no-decryption") {
+				log.WithField("name", *v.Name).Warn("skipping SecureString parameter of a prefix without decryption")
+				continue
+			}
+			if decrypt {
+				decrypted++
+			}
+		}
+		name := envName(*v.Name, prefix, longFileName)
+		if label != "" {
+			name = labeledEnvName(*v.Name, label)
+		}
+		resolved = append(resolved, resolvedParameter{Parameter: v, Source: sourceSSM, Prefix: prefix, EnvName: name, Region: region})
+	}
+	if c.GlobalBool("decryption-report") {
+		log.WithField("prefix", prefix).WithField("decrypted", decrypted).Info("decrypted SecureString parameters")
+	}
+	if min := minParams(c); len(resolved) < min {
+		return nil, fmt.Errorf("found %d parameters under %s, expected at least %d", len(resolved), prefix, min)
+	}
+	if len(resolved) == 0 {
+		log.WithField("prefix", prefix).Warn("prefix has no parameters, check it for typos")
+	}
+	return resolved, nil
+}
+
+// minParams returns the number of parameters every prefix must yield,
+// --min-params or 1 with --require-params.
+func minParams(c *cli.Context) int {
+	if min := c.GlobalInt("min-params"); min > 0 {
+		return min
+	}
+	if c.GlobalBool("require-params") {
+		return 1
+	}
+	return 0
+}
+
+// envName returns the env name of a parameter, its base name or with
+// longEnvName its path below prefix, uppercased and joined by underscores.
+func envName(name, prefix string, longEnvName bool) string {
+	varName := path.Base(name)
+	if longEnvName {
+		longKeyName := strings.TrimPrefix(name, prefix)
+		dir := path.Dir(longKeyName)
+		if dir != "." {
+			varName = strings.ReplaceAll(strings.ToUpper(path.Dir(longKeyName)), "/", "_") + "_" + varName
+		}
+	}
+	return varName
+}
+
+// fetchNamedParameters loads the parameters given by name with --param, in
+// the order given. Their long env name is their full path. Missing
+// parameters are an error unless --ignore-missing is set.
+func fetchNamedParameters(ctx context.Context, c *cli.Context, svc *ssm.Client) ([]resolvedParameter, error) {
+	names := c.GlobalStringSlice("param")
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	parameters, invalid, err := getParametersByName(ctx, svc, names, !c.GlobalBool("no-decryption"))
+	if err != nil {
+		return nil, err
+	}
+	if len(invalid) > 0 {
+		if !c.GlobalBool("ignore-missing") {
+			return nil, fmt.Errorf("parameters not found: %s", strings.Join(invalid, ", "))
+		}
+		for _, name := range invalid {
+			log.WithField("name", name).Warn("parameter not found, skipping")
+		}
+	}
+
+	byName := map[string]types.Parameter{}
+	for _, p := range parameters {
+		byName[*p.Name] = p
+	}
+	var resolved []resolvedParameter
+	for _, name := range names {
+		if p, ok := byName[name]; ok {
+			resolved = append(resolved, resolvedParameter{Parameter: p, Source: sourceSSM, EnvName: envName(name, "/", c.GlobalBool("long-env-name"))})
+		}
+	}
+	return resolved, nil
+}
+
+// normalizePrefix cleans up a prefix so /app, /app/ and //app// all
+// fetch the same path and produce the same env names: repeated slashes are
+// collapsed and it always ends with a slash.
+func normalizePrefix(prefix string) string {
+	if prefix == "" {
+		return prefix
+	}
+	prefix = path.Clean(prefix)
+	if prefix != "/" {
+		prefix += "/"
+	}
+	return prefix
+}
+
+// labeledEnvName returns the env name of a parameter of a labeled prefix, its
+// base name namespaced by the uppercased label.
+func labeledEnvName(name, label string) string {
+	return strings.ToUpper(label) + "_" + path.Base(name)
+}
+
+// prefixLabel matches a prefix with a label namespacing its env names, e.g.
+// db=/app/db
+var prefixLabel = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)=(.*)$`)
+
+// splitPrefixLabel splits a prefix of the form label=prefix into the label
+// and the prefix. Other prefixes are returned with an empty label.
+func splitPrefixLabel(prefix string) (string, string) {
+	if m := prefixLabel.FindStringSubmatch(prefix); m != nil {
+		return m[1], m[2]
+	}
+	return "", prefix
+}
+
+// regionPrefix matches a prefix qualified with a region, e.g. us-east-1:/app
+var regionPrefix = regexp.MustCompile(`^([a-z]{2}(?:-[a-z]+)+-[0-9]+):(/.*)$`)
+
+// validatePrefixLabels rejects labeled prefixes combined with
+// --long-env-name, which both decide the env names of a prefix.
+func validatePrefixLabels(c *cli.Context) error {
+	if !c.GlobalBool("long-env-name") {
+		return nil
+	}
+	all := append([]string{c.GlobalString("canary-prefix"), c.GlobalString("baseline-prefix")}, prefixes(c)...)
+	for _, prefix := range all {
+		if label, _ := splitPrefixLabel(prefix); label != "" {
+			return fmt.Errorf("the label of prefix %q can't be combined with long-env-name", prefix)
+		}
+	}
+	return nil
+}
+
+// splitRegionPrefix splits a prefix of the form region:/path into the region
+// and the path. Other prefixes are returned with an empty region.
+func splitRegionPrefix(prefix string) (string, string) {
+	if m := regionPrefix.FindStringSubmatch(prefix); m != nil {
+		return m[1], m[2]
+	}
+	return "", prefix
+}
+
+// decryptPrefix reports whether the SecureString parameters of prefix are
+// decrypted, which is the case unless it is listed in --no-decrypt-prefix.
+func decryptPrefix(c *cli.Context, prefix string) bool {
+	if c.GlobalBool("no-decryption") {
+		return false
+	}
+	for _, p := range c.GlobalStringSlice("no-decrypt-prefix") {
+		if normalizePrefix(p) == normalizePrefix(prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// awsClients caches the AWS configuration and the SSM client, so agent
+// refreshes and repeated fetches reuse them instead of resolving the
+// credentials again. The credentials cache of the configuration refreshes
+// expired credentials on its own.
+var awsClients struct {
+	mu       sync.Mutex
+	cfg      *aws.Config
+	ssm      *ssm.Client
+	regional map[string]*ssm.Client
+}
+
+// loadAWSConfig returns the default AWS configuration adjusted by the AWS
+// related flags, loading it on first use. A failed load is not cached.
+func loadAWSConfig(ctx context.Context, c *cli.Context) (aws.Config, error) {
+	awsClients.mu.Lock()
+	defer awsClients.mu.Unlock()
+	if awsClients.cfg != nil {
+		return *awsClients.cfg, nil
+	}
+	cfg, err := loadDefaultAWSConfig(ctx, c)
+	if err != nil {
+		return cfg, err
 	}
+	awsClients.cfg = &cfg
+	return cfg, nil
 }
 
-func action(c *cli.Context) error {
-	if c.GlobalBool("debug") {
-		log.SetLevel(log.DebugLevel)
+func loadDefaultAWSConfig(ctx context.Context, c *cli.Context) (aws.Config, error) {
+	var opts []func(*config.LoadOptions) error
+	if c.GlobalBool("use-fips") {
+		opts = append(opts, config.WithUseFIPSEndpoint(aws.FIPSEndpointStateEnabled))
 	}
-	if c.GlobalBool("silent") {
-		log.SetOutput(ioutil.Discard)
-	} else {
-		log.SetOutput(os.Stdout)
+	if region := c.GlobalString("region"); region != "" {
+		opts = append(opts, config.WithRegion(region))
 	}
-
-	if err := validateArgs(c); err != nil {
-		return cli.NewExitError(errorPrefix(err), ValidateArgsError)
+	opts = append(opts, config.WithHTTPClient(newHTTPClient(c)))
+	opts = append(opts, config.WithRetryer(newRetryer(c)))
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil || c.GlobalString("assume-role-arn") == "" {
+		return cfg, err
 	}
+	return assumeRole(ctx, c, cfg)
+}
 
-	if !c.GlobalBool("test") {
-		if err := getParameters(c); err != nil {
-			return cli.NewExitError(errorPrefix(err), GetParametersError)
+// assumeRole replaces the credentials of cfg with those of the
+// --assume-role-arn role, assumed with the ambient credentials. The role is
+// assumed right away, so a failure shows up before anything is fetched.
+func assumeRole(ctx context.Context, c *cli.Context, cfg aws.Config) (aws.Config, error) {
+	roleARN := c.GlobalString("assume-role-arn")
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), roleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = c.GlobalString("assume-role-session-name")
+		if externalID := c.GlobalString("external-id"); externalID != "" {
+			o.ExternalID = aws.String(externalID)
 		}
+	})
+	cfg.Credentials = aws.NewCredentialsCache(provider)
+	if _, err := cfg.Credentials.Retrieve(ctx); err != nil {
+		return cfg, fmt.Errorf("unable to assume role %s: %w", roleARN, err)
 	}
-
-	return runCommand(c)
+	log.WithField("role", roleARN).Debug("assumed role")
+	return cfg, nil
 }
 
-func cliFlags() []cli.Flag {
-	return []cli.Flag{
-		cli.StringSliceFlag{
-			Name:   "prefix, p",
-			Usage:  "Key prefix that is used to retrieve the environment variables - supports multiple use",
-			EnvVar: "PARAMS_PREFIX",
-		},
-		cli.BoolFlag{
-			Name:   "debug",
-			Usage:  "Log additional debugging information",
-			EnvVar: "PARAMS_DEBUG",
-		},
-		cli.BoolFlag{
-			Name:   "silent",
-			Usage:  "Silence all logs",
-			EnvVar: "PARAMS_SILENT",
-		},
-		cli.BoolFlag{
-			Name:   "long-env-name",
-			Usage:  "Use full key path as env name",
-			EnvVar: "LONG_ENV_NAME",
-		},
-		cli.StringFlag{
-			Name:   "procfile",
-			Usage:  "Path to procfile to use",
-			EnvVar: "PROCFILE",
-		},
-		cli.BoolFlag{
-			Name:   "test",
-			Usage:  "When running in test mode ssm-env will only launch the target app and will not attempt to read env from SSM",
-			EnvVar: "SSM_ENV_TEST",
-		},
-		cli.BoolFlag{
-			Name:   "no-expand",
-			Usage:  "ssm-env will not expand environment variables, to expand env VALUE must start from dollar ($) sign, for example HOME=$USER or HOME=${USER}",
-			EnvVar: "NO_EXPAND",
-		},
+// newHTTPClient returns the SDK's default HTTP client with the connection
+// phase timeouts applied. A zero timeout keeps the SDK default.
+func newHTTPClient(c *cli.Context) *awshttp.BuildableClient {
+	client := awshttp.NewBuildableClient()
+	if timeout := c.GlobalDuration("connect-timeout"); timeout > 0 {
+		client = client.WithDialerOptions(func(d *net.Dialer) {
+			d.Timeout = timeout
+		})
 	}
+	client = client.WithTransportOptions(func(tr *http.Transport) {
+		if timeout := c.GlobalDuration("tls-handshake-timeout"); timeout > 0 {
+			tr.TLSHandshakeTimeout = timeout
+		}
+		if timeout := c.GlobalDuration("response-header-timeout"); timeout > 0 {
+			tr.ResponseHeaderTimeout = timeout
+		}
+	})
+	return client
 }
 
-func errorPrefix(err error) string {
-	return strings.Join([]string{"ERROR:", err.Error()}, " ")
-}
-
-func escapeEnvVar(str string) string {
-	if str == "$" {
-		return "$"
+// newSSMClient returns the shared SSM client, creating it on first use.
+func newSSMClient(ctx context.Context, c *cli.Context) (*ssm.Client, error) {
+	awsClients.mu.Lock()
+	client := awsClients.ssm
+	awsClients.mu.Unlock()
+	if client != nil {
+		return client, nil
 	}
 
-	return os.Getenv(str)
+	client, err := createSSMClient(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	awsClients.mu.Lock()
+	defer awsClients.mu.Unlock()
+	if awsClients.ssm == nil {
+		awsClients.ssm = client
+	}
+	return awsClients.ssm, nil
 }
 
-func getParameters(c *cli.Context) error {
-	ctx := context.TODO()
-	longFileName := c.GlobalBool("long-env-name")
+// newRegionalSSMClient returns the shared SSM client of region, creating it
+// on first use. An empty region is the region of the AWS configuration.
+func newRegionalSSMClient(ctx context.Context, c *cli.Context, region string) (*ssm.Client, error) {
+	if region == "" {
+		return newSSMClient(ctx, c)
+	}
+	awsClients.mu.Lock()
+	client := awsClients.regional[region]
+	awsClients.mu.Unlock()
+	if client != nil {
+		return client, nil
+	}
 
-	cfg, err := config.LoadDefaultConfig(ctx)
+	client, err := createSSMClient(ctx, c, func(o *ssm.Options) {
+		o.Region = region
+	})
 	if err != nil {
-		log.Fatalf("unable to load SDK config, %v", err)
-		return err
+		return nil, err
 	}
-	svc := ssm.NewFromConfig(cfg)
-	for _, prefix := range c.GlobalStringSlice("prefix") {
-		parameters, err := getAllParametersByPath(ctx, svc, prefix)
-		if err != nil {
-			log.Fatalf("error loading SSM params, %v", err)
-			return err
-		}
-		for _, v := range parameters {
-			varName := path.Base(*v.Name)
-			if longFileName {
-				longKeyName := strings.Replace(*v.Name, strings.TrimSuffix(prefix, "/")+"/", "", 1)
-				dir := path.Dir(longKeyName)
-				if dir != "." {
-					varName = strings.ReplaceAll(strings.ToUpper(path.Dir(longKeyName)), "/", "_") + "_" + varName
-				}
-			}
-			if err := os.Setenv(varName, *v.Value); err != nil {
-				return err
-			}
-		}
+	awsClients.mu.Lock()
+	defer awsClients.mu.Unlock()
+	if awsClients.regional == nil {
+		awsClients.regional = map[string]*ssm.Client{}
+	}
+	if awsClients.regional[region] == nil {
+		awsClients.regional[region] = client
 	}
+	return awsClients.regional[region], nil
+}
 
-	if !c.GlobalBool("no-expand") {
-		for _, e := range os.Environ() {
-			pair := strings.SplitN(e, "=", 2)
-			if err := os.Setenv(pair[0], os.Expand(pair[1], escapeEnvVar)); err != nil {
-				log.Fatalf("error setting env params, %v", err)
-				return err
-			}
-		}
+func createSSMClient(ctx context.Context, c *cli.Context, optFns ...func(*ssm.Options)) (*ssm.Client, error) {
+	cfg, err := loadAWSConfig(ctx, c)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	if endpoint := c.GlobalString("ssm-endpoint-url"); endpoint != "" {
+		optFns = append(optFns, func(o *ssm.Options) {
+			o.EndpointResolver = ssmEndpointResolver(endpoint)
+		})
+	}
+	return ssm.NewFromConfig(cfg, optFns...), nil
 }
 
-func getAllParametersByPath(ctx context.Context, client *ssm.Client, path string) ([]types.Parameter, error) {
+// ssmEndpointResolver resolves every SSM endpoint to endpoint, signed for the
+// region of the client. Unlike ssm.EndpointResolverFromURL it doesn't modify
+// state shared by the requests, which race when prefixes are fetched
+// concurrently.
+func ssmEndpointResolver(endpoint string) ssm.EndpointResolver {
+	return ssm.EndpointResolverFunc(func(region string, options ssm.EndpointResolverOptions) (aws.Endpoint, error) {
+		return aws.Endpoint{URL: endpoint, SigningRegion: region, Source: aws.EndpointSourceCustom}, nil
+	})
+}
+
+func getAllParametersByPath(ctx context.Context, client *ssm.Client, path string, withDecryption, recursive bool, filters []types.ParameterStringFilter) ([]types.Parameter, error) {
 	var nextToken *string
 	var params []types.Parameter
-	var withDecryption bool = true
 
 	input := ssm.GetParametersByPathInput{
-		Path:           &path,
-		WithDecryption: &withDecryption,
+		Path:             &path,
+		WithDecryption:   &withDecryption,
+		Recursive:        &recursive,
+		ParameterFilters: filters,
 	}
 
 	for ok := true; ok; ok = nextToken != nil {
@@ -190,31 +1454,298 @@ func getAllParametersByPath(ctx context.Context, client *ssm.Client, path string
 	return params, nil
 }
 
+// parametersGetter is the part of the SSM API getParametersByName uses
+type parametersGetter interface {
+	GetParameters(ctx context.Context, params *ssm.GetParametersInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error)
+}
+
+// getParametersByName resolves fully qualified parameter names with
+// GetParameters, which accepts at most 10 names per call. Names that don't
+// exist are returned as invalid.
+func getParametersByName(ctx context.Context, client parametersGetter, names []string, withDecryption bool) ([]types.Parameter, []string, error) {
+	var params []types.Parameter
+	var invalid []string
+	for start := 0; start < len(names); start += 10 {
+		end := start + 10
+		if end > len(names) {
+			end = len(names)
+		}
+		result, err := client.GetParameters(ctx, &ssm.GetParametersInput{
+			Names:          names[start:end],
+			WithDecryption: &withDecryption,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		params = append(params, result.Parameters...)
+		invalid = append(invalid, result.InvalidParameters...)
+	}
+	return params, invalid, nil
+}
+
 func validateArgs(c *cli.Context) error {
-	if len(c.GlobalStringSlice("prefix")) == 0 {
-		return errors.New("prefix is required")
+	if len(prefixes(c)) == 0 && len(c.GlobalStringSlice("param")) == 0 && len(c.GlobalStringSlice("secrets-prefix")) == 0 && c.GlobalString("canary-prefix") == "" {
+		return errors.New("prefix, param or secrets-prefix is required")
+	}
+
+	if (c.GlobalString("canary-prefix") == "") != (c.GlobalString("baseline-prefix") == "") {
+		return errors.New("canary-prefix and baseline-prefix must be used together")
+	}
+
+	for _, mapping := range c.GlobalStringSlice("as-flag") {
+		if pair := strings.SplitN(mapping, "=", 2); len(pair) != 2 || pair[0] == "" || pair[1] == "" {
+			return fmt.Errorf("invalid as-flag %q, expected NAME=--flag", mapping)
+		}
+	}
+
+	if _, err := parseValidators(c); err != nil {
+		return err
+	}
+
+	if _, err := parseNameTransforms(c); err != nil {
+		return err
+	}
+
+	if _, err := parseRenderSpecs(c.GlobalStringSlice("render")); err != nil {
+		return err
+	}
+
+	if (c.GlobalString("cache-file") == "") != (c.GlobalDuration("cache-ttl") == 0) {
+		return errors.New("cache-file and cache-ttl must be used together")
+	}
+	if _, err := parseNameMatchers(c.GlobalStringSlice("include")); err != nil {
+		return fmt.Errorf("invalid include: %v", err)
+	}
+	if _, err := parseNameMatchers(c.GlobalStringSlice("exclude")); err != nil {
+		return fmt.Errorf("invalid exclude: %v", err)
+	}
+	if _, err := parseTagFilters(c.GlobalStringSlice("tag-filter")); err != nil {
+		return err
+	}
+	if err := validatePrefixLabels(c); err != nil {
+		return err
+	}
+
+	if _, err := parseForwardSignals(c.GlobalString("forward-signals")); err != nil {
+		return fmt.Errorf("invalid forward-signals: %v", err)
+	}
+	if c.GlobalDuration("shutdown-timeout") < 0 {
+		return errors.New("shutdown-timeout must not be negative")
+	}
+	if c.GlobalDuration("cache-ttl") < 0 {
+		return errors.New("cache-ttl must not be negative")
+	}
+
+	if endpoint := c.GlobalString("ssm-endpoint-url"); endpoint != "" {
+		if u, err := url.Parse(endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid ssm-endpoint-url %q, expected an absolute URL", endpoint)
+		}
+	}
+
+	if c.GlobalString("external-id") != "" && c.GlobalString("assume-role-arn") == "" {
+		return errors.New("external-id requires assume-role-arn")
 	}
 
-	if c.NArg() == 0 {
+	if c.GlobalBool("ssm-refs-cross-region") && !c.GlobalBool("resolve-ssm-refs") {
+		return errors.New("ssm-refs-cross-region requires resolve-ssm-refs")
+	}
+
+	if v := c.GlobalInt("vault-kv-version"); v != 1 && v != 2 {
+		return fmt.Errorf("invalid vault-kv-version %d, expected 1 or 2", v)
+	}
+
+	if len(commandLine(c)) == 0 && c.GlobalInt("write-fd") == 0 && c.GlobalString("since") == "" && c.GlobalString("dump-env") == "" && !c.GlobalBool("export") && !c.GlobalBool("dry-run") && !c.GlobalBool("all") {
 		return errors.New("command not specified")
 	}
 
+	if c.GlobalBool("all") {
+		if len(commandLine(c)) > 0 {
+			return errors.New("all runs every Procfile entry and can't be combined with a command")
+		}
+		// these supervise a single command
+		for _, name := range []string{"exec", "tty"} {
+			if c.GlobalBool(name) {
+				return fmt.Errorf("all can't be combined with %s", name)
+			}
+		}
+		if c.GlobalString("health-command") != "" {
+			return errors.New("all can't be combined with health-command")
+		}
+	}
+
+	switch c.GlobalString("unknown-command") {
+	case "exec", "shell", "error":
+	default:
+		return fmt.Errorf("invalid unknown-command mode %q, expected exec, shell or error", c.GlobalString("unknown-command"))
+	}
+
+	if c.GlobalInt("concurrency") < 1 {
+		return errors.New("concurrency must be at least 1")
+	}
+
+	if c.GlobalDuration("fetch-timeout") < 0 || c.GlobalDuration("prefix-timeout") < 0 {
+		return errors.New("fetch-timeout and prefix-timeout must not be negative")
+	}
+
+	if c.GlobalInt("min-params") < 0 {
+		return errors.New("min-params must not be negative")
+	}
+
+	if c.GlobalInt("max-retries") < 0 {
+		return errors.New("max-retries must not be negative")
+	}
+	if c.GlobalDuration("retry-base-delay") <= 0 {
+		return errors.New("retry-base-delay must be positive")
+	}
+
+	if c.GlobalBool("secrets-via-memfd") && runtime.GOOS != "linux" {
+		return errors.New("secrets-via-memfd is only supported on linux")
+	}
+
+	if c.GlobalBool("no-new-privs") && runtime.GOOS != "linux" {
+		return errors.New("no-new-privs is only supported on linux")
+	}
+
+	if c.GlobalBool("exec") {
+		if runtime.GOOS == "windows" {
+			return errors.New("exec is not supported on windows")
+		}
+		// these need ssm-env to keep running next to the command
+		for _, name := range []string{"tty", "secrets-via-memfd", "no-new-privs"} {
+			if c.GlobalBool(name) {
+				return fmt.Errorf("exec can't be combined with %s", name)
+			}
+		}
+		for _, name := range []string{"health-command", "agent-socket"} {
+			if c.GlobalString(name) != "" {
+				return fmt.Errorf("exec can't be combined with %s", name)
+			}
+		}
+		if c.GlobalInt("oom-exit-code") != 0 {
+			return errors.New("exec can't be combined with oom-exit-code")
+		}
+		if c.GlobalDuration("shutdown-timeout") > 0 {
+			return errors.New("exec can't be combined with shutdown-timeout")
+		}
+	}
+
+	for _, name := range []string{"connect-timeout", "tls-handshake-timeout", "response-header-timeout"} {
+		if c.GlobalDuration(name) < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+	}
+
+	if name := c.GlobalString("debug-signal"); name != "" {
+		if _, err := parseSignal(name); err != nil {
+			return fmt.Errorf("invalid debug-signal: %v", err)
+		}
+	}
+
+	if c.GlobalString("health-command") != "" {
+		if c.GlobalDuration("health-interval") <= 0 {
+			return errors.New("health-interval must be positive")
+		}
+		if c.GlobalInt("health-retries") < 1 {
+			return errors.New("health-retries must be at least 1")
+		}
+		if c.GlobalDuration("restart-backoff") < 0 || c.GlobalDuration("restart-backoff-max") < 0 {
+			return errors.New("restart-backoff and restart-backoff-max must not be negative")
+		}
+		if c.GlobalInt("max-restarts") < 0 {
+			return errors.New("max-restarts must not be negative")
+		}
+		if c.GlobalDuration("restart-window") <= 0 {
+			return errors.New("restart-window must be positive")
+		}
+	}
+
 	return nil
 }
 
-func invoke(command string, args []string) error {
+func startCommand(c *cli.Context, cmd *exec.Cmd) (func(), error) {
+	extraFiles, secretsFile, err := attachSecrets(cmd.ExtraFiles)
+	if err != nil {
+		return nil, err
+	}
+	if secretsFile != nil {
+		// the child has a descriptor of its own
+		defer secretsFile.Close()
+	}
+	cmd.ExtraFiles = extraFiles
+
+	start := func() (func(), error) {
+		if c.GlobalBool("tty") {
+			return startTTY(cmd)
+		}
+
+		// commands of --all come with their own output
+		if cmd.Stdout == nil {
+			cmd.Stdin = os.Stdin
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+		}
+		return func() {}, cmd.Start()
+	}
+	if c.GlobalBool("no-new-privs") {
+		return startWithNoNewPrivs(start)
+	}
+	return start()
+}
+
+func invoke(c *cli.Context, command string, args []string) error {
+	if c.GlobalBool("exec") {
+		err := execCommand(command, args)
+		return cli.NewExitError(errorPrefix(fmt.Errorf("unable to exec %s: %v", command, err)), RunCommandError)
+	}
+
+	// validated by validateArgs
+	extra, _ := parseForwardSignals(c.GlobalString("forward-signals"))
+	sigCh := make(chan os.Signal, 4)
+	signal.Notify(sigCh, append(forwardedSignals, extra...)...)
+	defer signal.Stop(sigCh)
+	stopDebug := watchDebugSignal(c)
+	defer stopDebug()
+
+	var restarts []time.Time
+	window := c.GlobalDuration("restart-window")
+	for {
+		restart, err := runChild(c, command, args, sigCh)
+		if !restart {
+			return err
+		}
+
+		now := time.Now()
+		restarts = recentRestarts(append(restarts, now), now, window)
+		if max := c.GlobalInt("max-restarts"); max > 0 && len(restarts) > max {
+			return cli.NewExitError(errorPrefix(fmt.Errorf("command restarted more than %d times within %s, giving up", max, window)), RunCommandError)
+		}
+
+		delay := restartDelay(c, len(restarts))
+		log.WithField("command", command).WithField("delay", delay.String()).Info("restarting command")
+		if !waitRestartBackoff(delay, sigCh) {
+			return nil
+		}
+	}
+}
+
+// runChild runs the command once, forwarding the signals received on sigCh to
+// it. It reports whether the command was stopped because it became unhealthy
+// and should be started again.
+func runChild(c *cli.Context, command string, args []string, sigCh <-chan os.Signal) (bool, error) {
 	cmd := exec.Command(command, args...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	oomKillsBefore, oomKnown := oomKillCount()
 
 	// in order to make sure that we catch and propagate signals correctly, we need
 	// to decouple starting the command and waiting for it to complete, so we can
 	// send signals as it runs
-	if err := cmd.Start(); err != nil {
+	cleanup, err := startCommand(c, cmd)
+	if err != nil {
 		log.WithError(err).Error("failed to start child process")
-		return err
+		return false, err
 	}
+	defer cleanup()
+	state.setChildPID(cmd.Process.Pid)
+	defer state.setChildPID(0)
 
 	// wait for the command to finish
 	errCh := make(chan error, 1)
@@ -222,57 +1753,228 @@ func invoke(command string, args []string) error {
 		errCh <- cmd.Wait()
 		close(errCh)
 	}()
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGABRT, syscall.SIGTERM)
+
+	unhealthyCh, stopHealth := watchHealth(c)
+	defer stopHealth()
+	restarting := false
+	var killCh <-chan time.Time
+	// shutdownTimer bounds how long the command may take to stop after the
+	// first termination request, it's stopped when the command exits
+	var shutdownTimer *time.Timer
+	var shutdownCh <-chan time.Time
+	defer func() {
+		if shutdownTimer != nil {
+			shutdownTimer.Stop()
+		}
+	}()
 
 	for {
 		select {
 		case sig := <-sigCh:
+			// a shutdown request wins over a pending restart
+			if sig == syscall.SIGINT || sig == syscall.SIGTERM {
+				restarting = false
+				if timeout := c.GlobalDuration("shutdown-timeout"); timeout > 0 && shutdownTimer == nil {
+					shutdownTimer = time.NewTimer(timeout)
+					shutdownCh = shutdownTimer.C
+				}
+			}
 			// this error case only seems possible if the OS has released the process
 			// or if it isn't started. So we _should_ be able to break
 			if err := cmd.Process.Signal(sig); err != nil {
 				log.WithError(err).WithField("signal", sig).Error("error sending signal")
-				return err
+				return false, err
+			}
+		case <-unhealthyCh:
+			log.Warn("command is unhealthy, stopping it for a restart")
+			restarting = true
+			if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+				_ = cmd.Process.Kill()
 			}
+			killCh = time.After(c.GlobalDuration("health-interval"))
+		case <-killCh:
+			log.Warn("unhealthy command did not stop, killing it")
+			_ = cmd.Process.Kill()
+		case <-shutdownCh:
+			log.WithField("timeout", c.GlobalDuration("shutdown-timeout").String()).Warn("command did not stop within the shutdown timeout, killing it")
+			_ = cmd.Process.Kill()
 		case err := <-errCh:
 			// the command finished.
+			if restarting {
+				return true, nil
+			}
+			if err != nil && killedBySIGKILL(err) {
+				return false, withCommandExitCode(handleKilled(c, err, oomKillsBefore, oomKnown))
+			}
 			if err != nil {
 				log.WithError(err).Error("command failed")
-				return err
+				return false, withCommandExitCode(err)
 			}
-			return nil
+			return false, nil
 		}
 	}
 }
 
+// handleKilled reports a child killed by SIGKILL, singling out kills by the
+// kernel OOM killer when the cgroup counters corroborate it.
+func handleKilled(c *cli.Context, err error, oomKillsBefore int, oomKnown bool) error {
+	oomKillsAfter, _ := oomKillCount()
+	if !oomKnown {
+		log.WithError(err).Error("command was killed by SIGKILL, possibly out of memory")
+		return err
+	}
+	if oomKillsAfter <= oomKillsBefore {
+		log.WithError(err).Error("command was killed by SIGKILL")
+		return err
+	}
+
+	log.WithError(err).WithField("oom_kills", oomKillsAfter-oomKillsBefore).Error("command was killed by the OOM killer")
+	if code := c.GlobalInt("oom-exit-code"); code != 0 {
+		return cli.NewExitError(errorPrefix(errors.New("command was killed by the OOM killer")), code)
+	}
+	return err
+}
+
 func runCommand(c *cli.Context) error {
-	command := c.Args().First()
-	procfileName := c.GlobalString("procfile")
-	if procfileName == "" {
-		procfileName = "Procfile"
+	command := commandLine(c).First()
+	procfileNames := c.GlobalStringSlice("procfile")
+	explicitProcfile := len(procfileNames) > 0
+	if !explicitProcfile {
+		procfileNames = []string{"Procfile"}
+	}
+
+	// later Procfiles override entries of earlier ones with the same name
+	processes := map[string]string{}
+	for _, procfileName := range procfileNames {
+		if _, err := os.Stat(procfileName); os.IsNotExist(err) {
+			// only the default Procfile is optional
+			if explicitProcfile {
+				return cli.NewExitError(errorPrefix(fmt.Errorf("procfile %s does not exist", procfileName)), RunCommandError)
+			}
+			continue
+		}
+
+		procContent, err := ioutil.ReadFile(procfileName)
+
+		if err != nil {
+			log.Fatalf("unable to read Procfile, %v", err)
+			os.Exit(RunCommandError)
+		}
+
+		for name, procCommand := range parseProcfile(procContent) {
+			if _, ok := processes[name]; ok {
+				log.WithField("process", name).WithField("procfile", procfileName).Debug("overriding Procfile entry")
+			}
+			processes[name] = procCommand
+		}
+	}
+
+	if c.GlobalBool("all") {
+		return runAll(c, processes)
 	}
 
-	if _, err := os.Stat(procfileName); os.IsNotExist(err) {
-		return invoke(command, c.Args().Tail())
+	if procCommand, ok := processes[command]; ok {
+		cmd, err := parseProcfileCommand(procCommand)
+		if err != nil {
+			return cli.NewExitError(errorPrefix(fmt.Errorf("invalid Procfile entry %s: %v", command, err)), RunCommandError)
+		}
+		// only the command of the entry is started, so the assignments
+		// can go into the environment of ssm-env
+		for _, assignment := range cmd.Env {
+			pair := strings.SplitN(assignment, "=", 2)
+			if err := os.Setenv(pair[0], pair[1]); err != nil {
+				return cli.NewExitError(errorPrefix(err), RunCommandError)
+			}
+		}
+		return invoke(c, cmd.Path, append(cmd.Args, asFlagArgs(c)...))
 	}
 
-	procContent, err := ioutil.ReadFile(procfileName)
+	return invokeUnknown(c, command, commandArgs(c))
+}
 
-	if err != nil {
-		log.Fatalf("unable to read Procfile, %v", err)
-		os.Exit(RunCommandError)
+// commandArgs returns the arguments of a directly invoked command, expanding
+// $VAR and ${VAR} references with the resolved environment when --expand-args
+// is set.
+func commandArgs(c *cli.Context) []string {
+	args := commandLine(c).Tail()
+	if !c.GlobalBool("expand-args") || c.GlobalBool("no-expand") {
+		return args
+	}
+
+	expanded := make([]string, len(args))
+	for i, arg := range args {
+		expanded[i] = os.Expand(arg, escapeEnvVar)
 	}
+	return expanded
+}
 
+// parseProcfile returns the name->command entries of a Procfile. When a name
+// is listed more than once within the same file the first entry is used.
+func parseProcfile(procContent []byte) map[string]string {
+	processes := map[string]string{}
 	for _, line := range strings.Split(string(procContent), "\n") {
 		line = strings.TrimSuffix(line, "\r")
 		if matches := procfileRegex.FindStringSubmatch(line); matches != nil {
 			name, procCommand := matches[1], matches[2]
-			if name == command {
-				cmdParts := strings.Split(strings.Trim(procCommand, " "), " ")
-				return invoke(cmdParts[0], cmdParts[1:])
+			if _, ok := processes[name]; !ok {
+				processes[name] = procCommand
 			}
 		}
 	}
+	return processes
+}
+
+// invokeUnknown runs a command that didn't match any Procfile entry according
+// to the --unknown-command mode.
+func invokeUnknown(c *cli.Context, command string, args []string) error {
+	switch c.GlobalString("unknown-command") {
+	case "error":
+		if _, err := exec.LookPath(command); err != nil {
+			err = fmt.Errorf("command %q is neither a Procfile entry nor an executable", command)
+			return cli.NewExitError(errorPrefix(err), RunCommandError)
+		}
+	case "shell":
+		script := append([]string{command}, args...)
+		for _, arg := range asFlagArgs(c) {
+			script = append(script, shellQuote(arg))
+		}
+		shell, shellArgs := shellCommand(strings.Join(script, " "))
+		return invoke(c, shell, shellArgs)
+	}
+
+	return invoke(c, command, append(args, asFlagArgs(c)...))
+}
+
+// asFlagArgs returns the command line flags built from --as-flag mappings.
+// A mapping NAME=--flag appends "--flag value", NAME=--flag= appends
+// "--flag=value". Unset env vars are skipped.
+func asFlagArgs(c *cli.Context) []string {
+	var args []string
+	for _, mapping := range c.GlobalStringSlice("as-flag") {
+		pair := strings.SplitN(mapping, "=", 2)
+		value, ok := os.LookupEnv(pair[0])
+		if !ok {
+			log.WithField("name", pair[0]).Warn("env var for as-flag is not set, skipping")
+			continue
+		}
+		if strings.HasSuffix(pair[1], "=") {
+			args = append(args, pair[1]+value)
+		} else {
+			args = append(args, pair[1], value)
+		}
+	}
+	return args
+}
+
+// shellQuote quotes str as a single word for POSIX shells.
+func shellQuote(str string) string {
+	return "'" + strings.ReplaceAll(str, "'", `'\''`) + "'"
+}
 
-	return invoke(command, c.Args().Tail())
+// shellCommand returns the command and arguments running script via the shell.
+func shellCommand(script string) (string, []string) {
+	if runtime.GOOS == "windows" {
+		return "cmd", []string{"/C", script}
+	}
+	return "/bin/sh", []string{"-c", script}
 }
@@ -0,0 +1,552 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/urfave/cli"
+)
+
+// helperEnvVar makes the test binary act as a command exiting as told, e.g.
+// "exit 3" or "signal 15", instead of running the tests. With "secrets" it
+// exits with 0 if it can read helperSecretsEnvVar from its secrets fd.
+const helperEnvVar = "SSM_ENV_TEST_HELPER"
+
+const helperSecretsEnvVar = "SSM_ENV_TEST_SECRETS"
+
+func TestMain(m *testing.M) {
+	if helper := os.Getenv(helperEnvVar); helper != "" {
+		runHelper(helper)
+	}
+	os.Exit(m.Run())
+}
+
+func runHelper(helper string) {
+	fields := strings.Fields(helper)
+	if fields[0] == "secrets" {
+		fd, _ := strconv.Atoi(os.Getenv(secretsFDEnvVar))
+		content, err := ioutil.ReadAll(os.NewFile(uintptr(fd), "secrets"))
+		if err != nil || string(content) != os.Getenv(helperSecretsEnvVar) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	n, _ := strconv.Atoi(fields[len(fields)-1])
+	if fields[0] == "signal" {
+		process, _ := os.FindProcess(os.Getpid())
+		_ = process.Signal(syscall.Signal(n))
+		// wait to be killed by the signal
+		time.Sleep(time.Minute)
+	}
+	os.Exit(n)
+}
+
+// newTestContext returns the context of an ssm-env command line with the
+// global options args.
+func newTestContext(t *testing.T, args ...string) *cli.Context {
+	t.Helper()
+	app := cli.NewApp()
+	app.Name = "ssm-env"
+	app.Flags = cliFlags()
+	return cli.NewContext(app, parseTestFlags(t, app.Flags, args), nil)
+}
+
+// newTestCommandContext returns the context of the subcommand command with
+// the options args below the global context parent.
+func newTestCommandContext(t *testing.T, parent *cli.Context, command cli.Command, args ...string) *cli.Context {
+	t.Helper()
+	c := cli.NewContext(parent.App, parseTestFlags(t, command.Flags, args), parent)
+	c.Command = command
+	return c
+}
+
+func parseTestFlags(t *testing.T, flags []cli.Flag, args []string) *flag.FlagSet {
+	t.Helper()
+	set := flag.NewFlagSet("ssm-env", flag.ContinueOnError)
+	set.SetOutput(ioutil.Discard)
+	for _, f := range flags {
+		f.Apply(set)
+	}
+	if err := set.Parse(args); err != nil {
+		t.Fatalf("parsing %v: %v", args, err)
+	}
+
+	// like the cli package, copy what was set by an alias to the other names,
+	// slices share their value between the names already
+	visited := map[string]bool{}
+	set.Visit(func(f *flag.Flag) {
+		visited[f.Name] = true
+	})
+	for _, f := range flags {
+		names := flagNames(f)
+		for _, name := range names {
+			if !visited[name] {
+				continue
+			}
+			for _, other := range names {
+				if _, slice := set.Lookup(other).Value.(*cli.StringSlice); other != name && !slice {
+					_ = set.Set(other, set.Lookup(name).Value.String())
+				}
+			}
+		}
+	}
+	return set
+}
+
+// fakeSSM serves GetParametersByPath, GetParameter and GetParameters from
+// parameters, a map of names to values of String parameters. Listing a path
+// waits for its delay first. The access keys of the requests are recorded in
+// accessKeys.
+type fakeSSM struct {
+	parameters map[string]string
+	delays     map[string]time.Duration
+
+	mu         sync.Mutex
+	accessKeys []string
+}
+
+var credentialScope = regexp.MustCompile(`Credential=([^/]+)/`)
+
+type fakeParameter struct {
+	Name    string
+	Value   string
+	Type    string
+	Version int64
+}
+
+func (f *fakeSSM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if m := credentialScope.FindStringSubmatch(r.Header.Get("Authorization")); m != nil {
+		f.mu.Lock()
+		f.accessKeys = append(f.accessKeys, m[1])
+		f.mu.Unlock()
+	}
+
+	var input struct {
+		Path      string
+		Recursive bool
+		Name      string
+		Names     []string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var output struct {
+		Parameters        []fakeParameter
+		InvalidParameters []string `json:",omitempty"`
+	}
+	output.Parameters = []fakeParameter{}
+	switch r.Header.Get("X-Amz-Target") {
+	case "AmazonSSM.GetParametersByPath":
+		time.Sleep(f.delays[input.Path])
+		for name, value := range f.parameters {
+			if rest := strings.TrimPrefix(name, input.Path); rest != name && (input.Recursive || !strings.Contains(rest, "/")) {
+				output.Parameters = append(output.Parameters, fakeParameter{Name: name, Value: value, Type: "String", Version: 1})
+			}
+		}
+	case "AmazonSSM.GetParameter":
+		value, ok := f.parameters[input.Name]
+		if !ok {
+			w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"__type": "ParameterNotFound"})
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		_ = json.NewEncoder(w).Encode(map[string]fakeParameter{"Parameter": {Name: input.Name, Value: value, Type: "String", Version: 1}})
+		return
+	case "AmazonSSM.GetParameters":
+		for _, name := range input.Names {
+			if value, ok := f.parameters[name]; ok {
+				output.Parameters = append(output.Parameters, fakeParameter{Name: name, Value: value, Type: "String", Version: 1})
+			} else {
+				output.InvalidParameters = append(output.InvalidParameters, name)
+			}
+		}
+	default:
+		http.Error(w, "unsupported operation", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	_ = json.NewEncoder(w).Encode(output)
+}
+
+// useFakeSSM makes the shared SSM client talk to fake for the rest of the
+// test.
+func useFakeSSM(t *testing.T, fake *fakeSSM) {
+	t.Helper()
+	client := newFakeSSMClient(t, fake, "us-east-1")
+	awsClients.mu.Lock()
+	defer awsClients.mu.Unlock()
+	awsClients.ssm = client
+	t.Cleanup(func() {
+		awsClients.mu.Lock()
+		defer awsClients.mu.Unlock()
+		awsClients.ssm = nil
+	})
+}
+
+// useRegionalFakeSSM makes the shared SSM client of region talk to fake for
+// the rest of the test.
+func useRegionalFakeSSM(t *testing.T, fake *fakeSSM, region string) {
+	t.Helper()
+	client := newFakeSSMClient(t, fake, region)
+	awsClients.mu.Lock()
+	defer awsClients.mu.Unlock()
+	awsClients.regional = map[string]*ssm.Client{region: client}
+	t.Cleanup(func() {
+		awsClients.mu.Lock()
+		defer awsClients.mu.Unlock()
+		awsClients.regional = nil
+	})
+}
+
+func newFakeSSMClient(t *testing.T, fake *fakeSSM, region string) *ssm.Client {
+	t.Helper()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return ssm.New(ssm.Options{
+		Region:           region,
+		Credentials:      credentials.NewStaticCredentialsProvider("id", "secret", ""),
+		EndpointResolver: ssmEndpointResolver(server.URL),
+		Retryer:          aws.NopRetryer{},
+	})
+}
+
+func TestFetchParametersKeepsPrefixOrder(t *testing.T) {
+	// the earlier a prefix, the longer it takes, so the fetches complete in
+	// the reverse order of the prefixes
+	useFakeSSM(t, &fakeSSM{
+		parameters: map[string]string{
+			"/first/KEY":  "first",
+			"/second/KEY": "second",
+			"/third/KEY":  "third",
+			"/first/ONLY": "first",
+		},
+		delays: map[string]time.Duration{
+			"/first/":  100 * time.Millisecond,
+			"/second/": 50 * time.Millisecond,
+		},
+	})
+	c := newTestContext(t, "-p", "/first", "-p", "/second", "-p", "/third", "--concurrency", "3")
+
+	parameters, err := fetchParameters(context.Background(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prefixes []string
+	values := map[string]string{}
+	for _, p := range parameters {
+		if len(prefixes) == 0 || prefixes[len(prefixes)-1] != p.Prefix {
+			prefixes = append(prefixes, p.Prefix)
+		}
+		values[p.EnvName] = *p.Value
+	}
+	if got := strings.Join(prefixes, ","); got != "/first/,/second/,/third/" {
+		t.Errorf("parameters ordered by prefix %s, want /first/,/second/,/third/", got)
+	}
+	if values["KEY"] != "third" {
+		t.Errorf("KEY = %q, want the value of the last prefix", values["KEY"])
+	}
+	if values["ONLY"] != "first" {
+		t.Errorf("ONLY = %q, want first", values["ONLY"])
+	}
+}
+
+func TestEnvNamesIgnoreTrailingSlash(t *testing.T) {
+	useFakeSSM(t, &fakeSSM{parameters: map[string]string{
+		"/app/KEY":         "key",
+		"/app/db/PASSWORD": "password",
+		"/app/db/ro/USER":  "reader",
+	}})
+	tests := []struct {
+		args  []string
+		names string
+	}{
+		{args: []string{"--recursive"}, names: "KEY,PASSWORD,USER"},
+		{args: []string{"--recursive", "--long-env-name"}, names: "KEY,DB_PASSWORD,DB_RO_USER"},
+	}
+	for _, tt := range tests {
+		for _, prefix := range []string{"/app", "/app/", "/app//", "/app/./"} {
+			t.Run(strings.Join(append(tt.args, prefix), " "), func(t *testing.T) {
+				c := newTestContext(t, append([]string{"-p", prefix}, tt.args...)...)
+				parameters, err := fetchParameters(context.Background(), c)
+				if err != nil {
+					t.Fatal(err)
+				}
+				byName := map[string]string{}
+				for _, p := range parameters {
+					byName[*p.Name] = p.EnvName
+				}
+				var names []string
+				for _, name := range []string{"/app/KEY", "/app/db/PASSWORD", "/app/db/ro/USER"} {
+					names = append(names, byName[name])
+				}
+				if got := strings.Join(names, ","); got != tt.names {
+					t.Errorf("env names %s, want %s", got, tt.names)
+				}
+			})
+		}
+	}
+}
+
+func TestNormalizePrefix(t *testing.T) {
+	tests := map[string]string{
+		"":           "",
+		"/":          "/",
+		"//":         "/",
+		"/app":       "/app/",
+		"/app/":      "/app/",
+		"/app//":     "/app/",
+		"/app/db/..": "/app/",
+		"/app/db":    "/app/db/",
+	}
+	for prefix, want := range tests {
+		if got := normalizePrefix(prefix); got != want {
+			t.Errorf("normalizePrefix(%q) = %q, want %q", prefix, got, want)
+		}
+	}
+}
+
+// unsetenv unsets name for the rest of the test.
+func unsetenv(t *testing.T, name string) {
+	t.Helper()
+	// restores the original value at the end of the test
+	t.Setenv(name, "")
+	os.Unsetenv(name)
+}
+
+// keepEnv restores the whole environment at the end of the test, for tests
+// of code that sets env vars of its own.
+func keepEnv(t *testing.T) {
+	t.Helper()
+	environ := os.Environ()
+	t.Cleanup(func() {
+		os.Clearenv()
+		for _, e := range environ {
+			pair := strings.SplitN(e, "=", 2)
+			os.Setenv(pair[0], pair[1])
+		}
+	})
+}
+
+// chdir changes the working directory for the rest of the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestUnknownCommandModes(t *testing.T) {
+	chdir(t, t.TempDir())
+	t.Setenv(helperEnvVar, "exit 5")
+	tests := []struct {
+		mode    string
+		command []string
+		code    int
+	}{
+		{mode: "exec", command: []string{os.Args[0]}, code: 5},
+		// not a binary
+		{mode: "exec", command: []string{"exit", "3"}, code: 1},
+		{mode: "shell", command: []string{"exit", "3"}, code: 3},
+		{mode: "shell", command: []string{os.Args[0]}, code: 5},
+		{mode: "error", command: []string{os.Args[0]}, code: 5},
+		{mode: "error", command: []string{"exit", "3"}, code: RunCommandError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+" "+strings.Join(tt.command, " "), func(t *testing.T) {
+			c := newTestContext(t, append([]string{"--unknown-command", tt.mode}, tt.command...)...)
+			if code := exitCode(runCommand(c)); code != tt.code {
+				t.Errorf("exit code %d, want %d", code, tt.code)
+			}
+		})
+	}
+}
+
+func TestMissingProcfile(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+	t.Setenv(helperEnvVar, "exit 4")
+	procfile := filepath.Join(dir, "Procfile.web")
+	if err := ioutil.WriteFile(procfile, []byte("web: "+filepath.ToSlash(os.Args[0])+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{name: "default Procfile missing", args: []string{os.Args[0]}, code: 4},
+		{name: "explicit Procfile missing", args: []string{"--procfile", "Procfile.missing", os.Args[0]}, code: RunCommandError},
+		{name: "one of the explicit Procfiles missing", args: []string{"--procfile", procfile, "--procfile", "Procfile.missing", "web"}, code: RunCommandError},
+		{name: "explicit Procfile", args: []string{"--procfile", procfile, "web"}, code: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := exitCode(runCommand(newTestContext(t, tt.args...))); code != tt.code {
+				t.Errorf("exit code %d, want %d", code, tt.code)
+			}
+		})
+	}
+}
+
+func TestNoOverwrite(t *testing.T) {
+	useFakeSSM(t, &fakeSSM{parameters: map[string]string{
+		"/app/PRESET": "from ssm",
+		"/app/EMPTY":  "from ssm",
+		"/app/UNSET":  "from ssm",
+	}})
+	tests := []struct {
+		args []string
+		want map[string]string
+	}{
+		{
+			args: []string{"-p", "/app"},
+			want: map[string]string{"PRESET": "from ssm", "EMPTY": "from ssm", "UNSET": "from ssm"},
+		},
+		{
+			args: []string{"-p", "/app", "--no-overwrite"},
+			want: map[string]string{"PRESET": "from the platform", "EMPTY": "", "UNSET": "from ssm"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			// getParameters also sets the expanded values of other env vars
+			keepEnv(t)
+			t.Setenv("PRESET", "from the platform")
+			// set, even if empty
+			t.Setenv("EMPTY", "")
+			unsetenv(t, "UNSET")
+
+			if _, err := getParameters(newTestContext(t, tt.args...)); err != nil {
+				t.Fatal(err)
+			}
+			for name, value := range tt.want {
+				if got := os.Getenv(name); got != value {
+					t.Errorf("%s = %q, want %q", name, got, value)
+				}
+			}
+		})
+	}
+}
+
+// expiringCredentials provides new credentials on every retrieval, valid for
+// expiry.
+type expiringCredentials struct {
+	expiry time.Duration
+
+	mu         sync.Mutex
+	retrievals int
+}
+
+func (p *expiringCredentials) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.retrievals++
+	return aws.Credentials{
+		AccessKeyID:     fmt.Sprintf("key-%d", p.retrievals),
+		SecretAccessKey: "secret",
+		CanExpire:       true,
+		Expires:         time.Now().Add(p.expiry),
+	}, nil
+}
+
+func TestSSMClientIsReused(t *testing.T) {
+	fake := &fakeSSM{parameters: map[string]string{"/app/KEY": "value"}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	provider := &expiringCredentials{expiry: 200 * time.Millisecond}
+	awsClients.mu.Lock()
+	awsClients.cfg = &aws.Config{
+		Region:      "us-east-1",
+		Credentials: aws.NewCredentialsCache(provider),
+		Retryer:     func() aws.Retryer { return aws.NopRetryer{} },
+	}
+	awsClients.mu.Unlock()
+	defer func() {
+		awsClients.mu.Lock()
+		defer awsClients.mu.Unlock()
+		awsClients.cfg, awsClients.ssm = nil, nil
+	}()
+	c := newTestContext(t, "-p", "/app", "--ssm-endpoint-url", server.URL)
+
+	var clients []*ssm.Client
+	fetch := func() {
+		t.Helper()
+		client, err := newSSMClient(context.Background(), c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clients = append(clients, client)
+		if _, err := fetchParameters(context.Background(), c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fetch()
+	fetch()
+	// let the credentials expire
+	time.Sleep(300 * time.Millisecond)
+	fetch()
+
+	for _, client := range clients[1:] {
+		if client != clients[0] {
+			t.Errorf("got a new SSM client, want the first one reused")
+		}
+	}
+	if provider.retrievals != 2 {
+		t.Errorf("credentials retrieved %d times, want 2", provider.retrievals)
+	}
+	if got := strings.Join(fake.accessKeys, ","); got != "key-1,key-1,key-2" {
+		t.Errorf("requests signed with %s, want key-1,key-1,key-2", got)
+	}
+}
+
+func TestPrefixLabelsExcludeLongEnvName(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr bool
+	}{
+		{args: []string{"-p", "db=/app/db", "-p", "/app"}},
+		{args: []string{"-p", "/app/db", "--long-env-name"}},
+		{args: []string{"-p", "db=/app/db", "--long-env-name"}, wantErr: true},
+		{args: []string{"-p", "/app", "-p", "db=eu-west-1:/app/db", "--long-env-name"}, wantErr: true},
+		{args: []string{"-p", "/app", "--common-prefix", "shared=/shared", "--long-env-name"}, wantErr: true},
+		{args: []string{"--canary-prefix", "next=/app/next", "--baseline-prefix", "/app/current", "--long-env-name"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			err := validateArgs(newTestContext(t, append(tt.args, "env")...))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateArgs() error = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+const (
+	// maskedValue replaces secret values in logs and output
+	maskedValue = "********"
+	// minSecretLength keeps short values like "1" or "true" from mangling
+	// every log line they happen to appear in
+	minSecretLength = 4
+)
+
+// secrets holds the values fetched by ssm-env, so they can be redacted from
+// logs and error messages wherever they show up. Redaction is disabled by
+// --unmask.
+var secrets struct {
+	mu       sync.RWMutex
+	disabled bool
+	values   map[string]bool
+	replacer *strings.Replacer
+}
+
+// configureMasking sets up redaction of the secrets in all log entries.
+func configureMasking(c *cli.Context) {
+	if c.GlobalBool("unmask") {
+		secrets.mu.Lock()
+		secrets.disabled = true
+		secrets.mu.Unlock()
+		log.Warn("--unmask is set, secrets are not masked in logs and output")
+		return
+	}
+	log.AddHook(maskHook{})
+}
+
+// registerSecrets marks values as secret.
+func registerSecrets(values ...string) {
+	secrets.mu.Lock()
+	defer secrets.mu.Unlock()
+	if secrets.values == nil {
+		secrets.values = map[string]bool{}
+	}
+	changed := false
+	for _, v := range values {
+		if len(v) >= minSecretLength && !secrets.values[v] {
+			secrets.values[v] = true
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+
+	// longer values first, so a secret containing another one is masked as
+	// a whole
+	sorted := make([]string, 0, len(secrets.values))
+	for v := range secrets.values {
+		sorted = append(sorted, v)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	pairs := make([]string, 0, 2*len(sorted))
+	for _, v := range sorted {
+		pairs = append(pairs, v, maskedValue)
+	}
+	secrets.replacer = strings.NewReplacer(pairs...)
+}
+
+// registerParameterSecrets marks the values of parameters as secret.
+func registerParameterSecrets(parameters []resolvedParameter) {
+	values := make([]string, 0, len(parameters))
+	for _, p := range parameters {
+		values = append(values, *p.Value)
+	}
+	registerSecrets(values...)
+}
+
+// maskValue returns the placeholder shown instead of a secret value, or the
+// value itself with --unmask.
+func maskValue(value string) string {
+	secrets.mu.RLock()
+	defer secrets.mu.RUnlock()
+	if secrets.disabled {
+		return value
+	}
+	return maskedValue
+}
+
+// redactSecrets replaces every known secret in s.
+func redactSecrets(s string) string {
+	secrets.mu.RLock()
+	defer secrets.mu.RUnlock()
+	if secrets.disabled || secrets.replacer == nil {
+		return s
+	}
+	return secrets.replacer.Replace(s)
+}
+
+// maskHook redacts the secrets from the message and fields of log entries
+type maskHook struct{}
+
+func (maskHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (maskHook) Fire(entry *log.Entry) error {
+	entry.Message = redactSecrets(entry.Message)
+	for key, value := range entry.Data {
+		switch v := value.(type) {
+		case string:
+			entry.Data[key] = redactSecrets(v)
+		case error:
+			entry.Data[key] = redactSecrets(v.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// captureLogs sends the log entries of the rest of the test to a buffer, at
+// debug level and with the secrets masked.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	logger := log.StandardLogger()
+	var buf bytes.Buffer
+	output, level := logger.Out, logger.GetLevel()
+	hooks := logger.ReplaceHooks(log.LevelHooks{})
+	logger.SetOutput(&buf)
+	logger.SetLevel(log.DebugLevel)
+	logger.AddHook(maskHook{})
+	t.Cleanup(func() {
+		logger.SetOutput(output)
+		logger.SetLevel(level)
+		logger.ReplaceHooks(hooks)
+
+		secrets.mu.Lock()
+		defer secrets.mu.Unlock()
+		secrets.values, secrets.replacer = nil, nil
+	})
+	return &buf
+}
+
+func TestSecretsAreMaskedInDebugLogs(t *testing.T) {
+	values := map[string]string{
+		"/app/DB_PASSWORD": "s3cr3t-password",
+		"/app/API_TOKEN":   "tok-0123456789",
+		"/app/DEBUG":       "on",
+	}
+	useFakeSSM(t, &fakeSSM{parameters: values})
+	buf := captureLogs(t)
+
+	c := newTestContext(t, "-p", "/app")
+	if _, err := fetchParameters(context.Background(), c); err != nil {
+		t.Fatal(err)
+	}
+	log.Debugf("connecting with s3cr3t-password")
+	log.WithField("token", "Bearer tok-0123456789").Debug("calling the API")
+	log.WithError(errors.New("login failed for s3cr3t-password")).Error("unable to connect")
+
+	out := buf.String()
+	for name, value := range values {
+		if len(value) >= minSecretLength && strings.Contains(out, value) {
+			t.Errorf("logs contain the value of %s:\n%s", name, out)
+		}
+	}
+	if n := strings.Count(out, maskedValue); n != 3 {
+		t.Errorf("logs contain %d masked values, want 3:\n%s", n, out)
+	}
+}
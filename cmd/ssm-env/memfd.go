@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strconv"
+)
+
+// secretsFDEnvVar tells the child which fd holds its secrets
+const secretsFDEnvVar = "SSM_ENV_SECRETS_FD"
+
+// sharedSecrets holds the dotenv formatted secrets passed to the children via
+// memfd, if --secrets-via-memfd is set
+var sharedSecrets struct {
+	enabled bool
+	content []byte
+}
+
+// shareSecrets makes the secrets available to the children in a sealed
+// in-memory file instead of their environment.
+func shareSecrets(secrets []envVar) error {
+	sharedSecrets.enabled = true
+	sharedSecrets.content = []byte(formatDotenv(secrets))
+	// extra files start after stdin, stdout and stderr
+	return os.Setenv(secretsFDEnvVar, strconv.Itoa(3))
+}
+
+// attachSecrets passes a new memfd with the secrets to a child as the first
+// of its extra files. Every (re)started child gets its own memfd, so children
+// of --all don't share the file offset. The returned file is to be closed
+// once the child is started.
+func attachSecrets(files []*os.File) ([]*os.File, *os.File, error) {
+	if !sharedSecrets.enabled {
+		return files, nil, nil
+	}
+	f, err := createSealedMemfd("ssm-env-secrets", sharedSecrets.content)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the child reads from the start
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+	return append([]*os.File{f}, files...), f, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestEveryChildReadsAllSecrets(t *testing.T) {
+	secrets := []envVar{{Name: "DB_PASSWORD", Value: "s3cr3t"}, {Name: "API_TOKEN", Value: "t0k3n"}}
+	unsetenv(t, secretsFDEnvVar)
+	if err := shareSecrets(secrets); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		sharedSecrets.enabled, sharedSecrets.content = false, nil
+	}()
+	t.Setenv(helperEnvVar, "secrets")
+	t.Setenv(helperSecretsEnvVar, formatDotenv(secrets))
+
+	// like the processes of --all, all children run at the same time
+	c := newTestContext(t)
+	var cmds []*exec.Cmd
+	for i := 0; i < 4; i++ {
+		cmd := exec.Command(os.Args[0])
+		cleanup, err := startCommand(c, cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cleanup()
+		cmds = append(cmds, cmd)
+	}
+	for i, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Errorf("child %d didn't read all secrets: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+func createSealedMemfd(name string, content []byte) (*os.File, error) {
+	return nil, errors.New("secrets-via-memfd is only supported on linux")
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+var (
+	shellIdentifier   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	nonIdentifierChar = regexp.MustCompile(`[^A-Za-z0-9_]`)
+	nonAlphanumeric   = regexp.MustCompile(`[^A-Za-z0-9]`)
+)
+
+// nameTransform is a parsed sed-like s/pattern/replacement/flags expression
+type nameTransform struct {
+	pattern     *regexp.Regexp
+	replacement string
+	global      bool
+}
+
+// parseNameTransform parses a sed substitution. Any character can be used as
+// the delimiter and escaped with a backslash. The flags g (replace all
+// matches instead of the first) and i (ignore case) are supported. In the
+// replacement \1 to \9 refer to groups and & to the whole match.
+func parseNameTransform(expr string) (nameTransform, error) {
+	if len(expr) < 2 || expr[0] != 's' {
+		return nameTransform{}, fmt.Errorf("invalid name-transform %q, expected s/pattern/replacement/", expr)
+	}
+	delim := expr[1]
+	var parts []string
+	var current strings.Builder
+	for i := 2; i < len(expr); i++ {
+		switch {
+		case expr[i] == '\\' && i+1 < len(expr) && expr[i+1] == delim:
+			current.WriteByte(delim)
+			i++
+		case expr[i] == '\\' && i+1 < len(expr):
+			current.WriteByte(expr[i])
+			current.WriteByte(expr[i+1])
+			i++
+		case expr[i] == delim:
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(expr[i])
+		}
+	}
+	parts = append(parts, current.String())
+	if len(parts) != 3 {
+		return nameTransform{}, fmt.Errorf("invalid name-transform %q, expected s/pattern/replacement/", expr)
+	}
+
+	t := nameTransform{replacement: sedReplacement(parts[1])}
+	pattern := parts[0]
+	for _, flag := range parts[2] {
+		switch flag {
+		case 'g':
+			t.global = true
+		case 'i':
+			pattern = "(?i)" + pattern
+		default:
+			return nameTransform{}, fmt.Errorf("invalid name-transform %q, unknown flag %q", expr, flag)
+		}
+	}
+	var err error
+	if t.pattern, err = regexp.Compile(pattern); err != nil {
+		return nameTransform{}, fmt.Errorf("invalid name-transform %q: %v", expr, err)
+	}
+	return t, nil
+}
+
+// sedReplacement converts a sed replacement to the template syntax of regexp.
+func sedReplacement(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			sb.WriteString("${" + string(s[i+1]) + "}")
+			i++
+		case s[i] == '\\' && i+1 < len(s):
+			sb.WriteByte(s[i+1])
+			i++
+		case s[i] == '&':
+			sb.WriteString("${0}")
+		case s[i] == '$':
+			sb.WriteString("$$")
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String()
+}
+
+func (t nameTransform) apply(name string) string {
+	if t.global {
+		return t.pattern.ReplaceAllString(name, t.replacement)
+	}
+	if loc := t.pattern.FindStringSubmatchIndex(name); loc != nil {
+		var dst []byte
+		dst = t.pattern.ExpandString(dst, t.replacement, name, loc)
+		return name[:loc[0]] + string(dst) + name[loc[1]:]
+	}
+	return name
+}
+
+func parseNameTransforms(c *cli.Context) ([]nameTransform, error) {
+	var transforms []nameTransform
+	for _, expr := range c.GlobalStringSlice("name-transform") {
+		t, err := parseNameTransform(expr)
+		if err != nil {
+			return nil, err
+		}
+		transforms = append(transforms, t)
+	}
+	return transforms, nil
+}
+
+// transformNames applies --name-transform and --upcase to the env names of
+// the parameters. Names that are not valid shell identifiers are an error
+// with --strict-names and are sanitized otherwise, by replacing invalid
+// characters with underscores and prefixing names starting with a digit.
+func transformNames(c *cli.Context, parameters []resolvedParameter) error {
+	transforms, err := parseNameTransforms(c)
+	if err != nil {
+		return err
+	}
+	for i := range parameters {
+		name := parameters[i].EnvName
+		for _, t := range transforms {
+			name = t.apply(name)
+		}
+		if c.GlobalBool("upcase") {
+			name = nonAlphanumeric.ReplaceAllString(strings.ToUpper(name), "_")
+		}
+
+		if !shellIdentifier.MatchString(name) {
+			if c.GlobalBool("strict-names") {
+				return fmt.Errorf("parameter %s maps to the invalid env name %q", *parameters[i].Name, name)
+			}
+			name = nonIdentifierChar.ReplaceAllString(name, "_")
+			if name == "" || (name[0] >= '0' && name[0] <= '9') {
+				name = "_" + name
+			}
+		}
+		parameters[i].EnvName = name
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// startWithNoNewPrivs calls start on a dedicated OS thread that has
+// PR_SET_NO_NEW_PRIVS set, which the child inherits across fork and exec.
+// The thread is never unlocked, so the runtime discards it afterwards instead
+// of reusing it for ssm-env itself.
+func startWithNoNewPrivs(start func() (func(), error)) (func(), error) {
+	type result struct {
+		cleanup func()
+		err     error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		runtime.LockOSThread()
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			resultCh <- result{err: err}
+			return
+		}
+		cleanup, err := start()
+		resultCh <- result{cleanup, err}
+	}()
+	r := <-resultCh
+	return r.cleanup, r.err
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func startWithNoNewPrivs(start func() (func(), error)) (func(), error) {
+	return nil, errors.New("no-new-privs is only supported on linux")
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// environSize returns the number of bytes the environment takes up when
+// passed to exec, including the terminating NUL of every entry.
+func environSize() int {
+	size := 0
+	for _, e := range os.Environ() {
+		size += len(e) + 1
+	}
+	return size
+}
+
+// offloadLargeValues moves the largest parameter values out of the
+// environment into files until the environment fits --auto-offload-threshold.
+// Every offloaded NAME is replaced by NAME_FILE holding the file path. It
+// returns the directory holding the files, which is empty if nothing was
+// offloaded.
+func offloadLargeValues(c *cli.Context, parameters []resolvedParameter) (string, error) {
+	threshold := c.GlobalInt("auto-offload-threshold")
+	if threshold <= 0 || environSize() <= threshold {
+		return "", nil
+	}
+
+	var candidates []envVar
+	seen := map[string]bool{}
+	for _, p := range parameters {
+		if seen[p.EnvName] {
+			continue
+		}
+		seen[p.EnvName] = true
+		if value, ok := os.LookupEnv(p.EnvName); ok {
+			candidates = append(candidates, envVar{Name: p.EnvName, Value: value})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return len(candidates[i].Value) > len(candidates[j].Value) })
+
+	dir := ""
+	for _, v := range candidates {
+		if environSize() <= threshold {
+			break
+		}
+		if dir == "" {
+			var err error
+			if dir, err = ioutil.TempDir(c.GlobalString("offload-dir"), "ssm-env-"); err != nil {
+				return "", err
+			}
+		}
+
+		file := filepath.Join(dir, v.Name)
+		if err := ioutil.WriteFile(file, []byte(v.Value), 0600); err != nil {
+			return dir, err
+		}
+		if err := os.Unsetenv(v.Name); err != nil {
+			return dir, err
+		}
+		if err := os.Setenv(v.Name+"_FILE", file); err != nil {
+			return dir, err
+		}
+		log.WithField("name", v.Name).WithField("bytes", len(v.Value)).WithField("file", file).Info("offloaded large value to file")
+	}
+
+	if size := environSize(); size > threshold {
+		log.WithField("bytes", size).WithField("threshold", threshold).Warn("environment still exceeds the offload threshold")
+	}
+	return dir, nil
+}
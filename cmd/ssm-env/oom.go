@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// cgroup v2 and v1 files exposing the oom_kill counter of the current cgroup
+var oomEventFiles = []string{
+	"/sys/fs/cgroup/memory.events",
+	"/sys/fs/cgroup/memory/memory.oom_control",
+}
+
+// oomKillCount returns the number of OOM kills recorded for our cgroup, and
+// false when no cgroup memory accounting is available (e.g. outside linux).
+func oomKillCount() (int, bool) {
+	for _, name := range oomEventFiles {
+		content, err := ioutil.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 2 && fields[0] == "oom_kill" {
+				if count, err := strconv.Atoi(fields[1]); err == nil {
+					return count, true
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+func killedBySIGKILL(err error) bool {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	return ok && status.Signaled() && status.Signal() == syscall.SIGKILL
+}
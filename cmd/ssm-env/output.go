@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+)
+
+// resolvedVars returns the final value of every env var set from the
+// parameters, sorted by name. Values are taken from the environment, so they
+// reflect expansion, and fall back to the parameter value for variables that
+// were not injected into it.
+func resolvedVars(parameters []resolvedParameter) []envVar {
+	values := map[string]string{}
+	for _, p := range parameters {
+		values[p.EnvName] = *p.Value
+	}
+
+	vars := make([]envVar, 0, len(values))
+	for name, value := range values {
+		if v, ok := os.LookupEnv(name); ok {
+			value = v
+		}
+		vars = append(vars, envVar{Name: name, Value: value})
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+	return vars
+}
+
+// formatExports serializes vars as single quoted shell export statements.
+func formatExports(vars []envVar) string {
+	var sb strings.Builder
+	for _, v := range vars {
+		sb.WriteString("export " + v.Name + "=" + shellQuote(v.Value) + "\n")
+	}
+	return sb.String()
+}
+
+// writeExportsToFD writes the export statements to an already open file
+// descriptor, inherited from the parent process.
+func writeExportsToFD(fd int, parameters []resolvedParameter) error {
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd))
+	defer f.Close()
+
+	if _, err := f.WriteString(formatExports(resolvedVars(parameters))); err != nil {
+		return fmt.Errorf("unable to write to fd %d: %v", fd, err)
+	}
+	return nil
+}
+
+// writeDotenvFile writes the resolved vars sorted by name to file in dotenv
+// format. The file is only readable by the user, as it holds secrets.
+func writeDotenvFile(file string, parameters []resolvedParameter) error {
+	if err := ioutil.WriteFile(file, []byte(formatDotenv(resolvedVars(parameters))), 0600); err != nil {
+		return fmt.Errorf("unable to write %s: %v", file, err)
+	}
+	return nil
+}
+
+// emitDotenvVar serializes the injected parameters as a dotenv blob into the
+// env var --emit-dotenv-var. Parameters kept out of the environment, such as
+// secrets shared via memfd, are not included. With --emit-dotenv-only the
+// individual vars are removed from the environment afterwards.
+func emitDotenvVar(c *cli.Context, parameters []resolvedParameter) error {
+	name := c.GlobalString("emit-dotenv-var")
+	if name == "" {
+		return nil
+	}
+
+	var vars []envVar
+	for _, v := range resolvedVars(parameters) {
+		if _, ok := os.LookupEnv(v.Name); ok {
+			vars = append(vars, v)
+		}
+	}
+	if err := os.Setenv(name, formatDotenv(vars)); err != nil {
+		return err
+	}
+
+	if c.GlobalBool("emit-dotenv-only") {
+		for _, v := range vars {
+			if v.Name == name {
+				continue
+			}
+			if err := os.Unsetenv(v.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// formatDryRun renders the parameters as a table of parameter path, env name
+// and masked value, in the order they are applied. Parameters overridden by a
+// later one of the same env name are marked as such.
+func formatDryRun(parameters []resolvedParameter) string {
+	winners := map[string]int{}
+	for i, p := range parameters {
+		winners[p.EnvName] = i
+	}
+
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PARAMETER\t\tENV NAME\tVALUE")
+	for i, p := range parameters {
+		value := maskValue(*p.Value)
+		if winners[p.EnvName] != i {
+			value += " (overridden)"
+		}
+		fmt.Fprintf(w, "%s\t->\t%s\t%s\n", *p.Name, p.EnvName, value)
+	}
+	w.Flush()
+	return sb.String()
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// placeholderName is the base name of the marker parameter created by
+// --create-missing-prefix. It is never exported to the environment.
+const placeholderName = "_ssm-env-placeholder"
+
+func isPlaceholder(name string) bool {
+	return path.Base(name) == placeholderName
+}
+
+// createPlaceholder creates the marker parameter in an empty prefix so the
+// hierarchy exists, a convenience for the first run of a new service during
+// development. Nothing is written without --confirm.
+func createPlaceholder(ctx context.Context, c *cli.Context, svc *ssm.Client, prefix string) error {
+	name := path.Join(prefix, placeholderName)
+	entry := log.WithField("prefix", prefix).WithField("name", name)
+	if !c.GlobalBool("confirm") {
+		entry.Warn("prefix is empty, not creating a placeholder without --confirm")
+		return nil
+	}
+
+	_, err := svc.PutParameter(ctx, &ssm.PutParameterInput{
+		Name:        aws.String(name),
+		Value:       aws.String("created by ssm-env --create-missing-prefix"),
+		Type:        types.ParameterTypeString,
+		Description: aws.String("Marks the prefix of a new service, safe to delete once it holds parameters"),
+	})
+	var exists *types.ParameterAlreadyExists
+	if errors.As(err, &exists) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	entry.Warn("created placeholder parameter in SSM for the empty prefix, --create-missing-prefix is for development only")
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var envAssignment = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// procfileCommand is a parsed Procfile entry
+type procfileCommand struct {
+	// Env holds the NAME=value assignments before the command
+	Env  []string
+	Path string
+	Args []string
+}
+
+// parseProcfileCommand splits a Procfile entry into words like a POSIX shell
+// does, without expansion, and separates leading NAME=value assignments,
+// which set env vars for the process only.
+func parseProcfileCommand(line string) (procfileCommand, error) {
+	words, err := splitShellWords(line)
+	if err != nil {
+		return procfileCommand{}, err
+	}
+	var cmd procfileCommand
+	for len(words) > 0 && envAssignment.MatchString(words[0]) {
+		cmd.Env = append(cmd.Env, words[0])
+		words = words[1:]
+	}
+	if len(words) == 0 {
+		return procfileCommand{}, errors.New("no command")
+	}
+	cmd.Path, cmd.Args = words[0], words[1:]
+	return cmd, nil
+}
+
+// splitShellWords splits s at unquoted whitespace. Single quotes preserve
+// everything up to the closing quote, double quotes preserve everything but
+// backslash escapes of ", \, $ and `, and a backslash outside of quotes
+// escapes any character. Quoted empty strings are kept as empty words.
+func splitShellWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == ' ' || ch == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case ch == '\\':
+			if i+1 == len(s) {
+				return nil, errors.New("trailing backslash")
+			}
+			i++
+			word.WriteByte(s[i])
+			inWord = true
+		case ch == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote at %d", i)
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case ch == '"':
+			start := i
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\"\\$`", s[i+1]) >= 0 {
+					i++
+				}
+				word.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return nil, fmt.Errorf("unterminated double quote at %d", start)
+			}
+			inWord = true
+		default:
+			word.WriteByte(ch)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
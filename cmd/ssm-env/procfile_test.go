@@ -0,0 +1,93 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitShellWords(t *testing.T) {
+	tests := []struct {
+		line    string
+		words   []string
+		wantErr bool
+	}{
+		{line: "", words: nil},
+		{line: "  \t ", words: nil},
+		{line: "bin/web --port 8080", words: []string{"bin/web", "--port", "8080"}},
+		{line: "  bin/web \t --port  8080  ", words: []string{"bin/web", "--port", "8080"}},
+		{line: `echo 'hello world'`, words: []string{"echo", "hello world"}},
+		{line: `echo 'a "b" \c $d'`, words: []string{"echo", `a "b" \c $d`}},
+		{line: `echo "hello world"`, words: []string{"echo", "hello world"}},
+		{line: `echo "a \"b\" \\ \$c \` + "`" + `d\e"`, words: []string{"echo", `a "b" \ $c ` + "`" + `d\e`}},
+		{line: `echo "it's"`, words: []string{"echo", "it's"}},
+		{line: `echo hello\ world`, words: []string{"echo", "hello world"}},
+		{line: `echo \'a\" \\`, words: []string{"echo", `'a"`, `\`}},
+		{line: `echo pre'fix'"ed"`, words: []string{"echo", "prefixed"}},
+		{line: `echo '' ""`, words: []string{"echo", "", ""}},
+		{line: `echo a '' b`, words: []string{"echo", "a", "", "b"}},
+		{line: `echo 'unterminated`, wantErr: true},
+		{line: `echo "unterminated`, wantErr: true},
+		{line: `echo "escaped quote\"`, wantErr: true},
+		{line: `echo trailing\`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			words, err := splitShellWords(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitShellWords(%q) error = %v, want error %t", tt.line, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(words, tt.words) {
+				t.Errorf("splitShellWords(%q) = %q, want %q", tt.line, words, tt.words)
+			}
+		})
+	}
+}
+
+func TestParseProcfileCommand(t *testing.T) {
+	tests := []struct {
+		line    string
+		cmd     procfileCommand
+		wantErr bool
+	}{
+		{
+			line: "bin/web --port 8080",
+			cmd:  procfileCommand{Path: "bin/web", Args: []string{"--port", "8080"}},
+		},
+		{
+			line: "bin/worker",
+			cmd:  procfileCommand{Path: "bin/worker", Args: []string{}},
+		},
+		{
+			line: "PORT=8080 DEBUG= bin/web",
+			cmd:  procfileCommand{Env: []string{"PORT=8080", "DEBUG="}, Path: "bin/web", Args: []string{}},
+		},
+		{
+			line: `GREETING='hello world' bin/greet NAME=arg`,
+			cmd:  procfileCommand{Env: []string{"GREETING=hello world"}, Path: "bin/greet", Args: []string{"NAME=arg"}},
+		},
+		{
+			// not a valid name, so it is the command
+			line: "1PORT=8080 bin/web",
+			cmd:  procfileCommand{Path: "1PORT=8080", Args: []string{"bin/web"}},
+		},
+		{
+			line: `bin/web ""`,
+			cmd:  procfileCommand{Path: "bin/web", Args: []string{""}},
+		},
+		{line: "", wantErr: true},
+		{line: "PORT=8080", wantErr: true},
+		{line: "PORT=8080 DEBUG=1", wantErr: true},
+		{line: `bin/web "--port`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			cmd, err := parseProcfileCommand(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseProcfileCommand(%q) error = %v, want error %t", tt.line, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(cmd, tt.cmd) {
+				t.Errorf("parseProcfileCommand(%q) = %+v, want %+v", tt.line, cmd, tt.cmd)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// prefixedOutput serializes the output of several processes line by line,
+// each line prefixed with the name of the process that wrote it
+type prefixedOutput struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// prefixWriter buffers the output of one process until a line is complete
+type prefixWriter struct {
+	out    *prefixedOutput
+	prefix string
+	buf    []byte
+}
+
+func (o *prefixedOutput) writer(prefix string) *prefixWriter {
+	return &prefixWriter{out: o, prefix: prefix}
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		w.writeLine(w.buf[:i+1])
+		w.buf = w.buf[i+1:]
+	}
+}
+
+// flush writes a last line that wasn't terminated by a newline.
+func (w *prefixWriter) flush() {
+	if len(w.buf) > 0 {
+		w.writeLine(append(w.buf, '\n'))
+		w.buf = nil
+	}
+}
+
+func (w *prefixWriter) writeLine(line []byte) {
+	w.out.mu.Lock()
+	defer w.out.mu.Unlock()
+	_, _ = w.out.w.Write(append([]byte(w.prefix), line...))
+}
+
+// processExit is the result of one process of --all
+type processExit struct {
+	name string
+	err  error
+}
+
+// runAll starts every Procfile entry concurrently, foreman style: the output
+// of the processes is prefixed with their names, signals are forwarded to all
+// of them, and once any process exits the others are stopped. ssm-env exits
+// with the exit code of the process that exited first.
+func runAll(c *cli.Context, processes map[string]string) error {
+	if len(processes) == 0 {
+		return cli.NewExitError(errorPrefix(errors.New("the Procfile has no entries to run")), RunCommandError)
+	}
+	names := make([]string, 0, len(processes))
+	width := 0
+	for name := range processes {
+		names = append(names, name)
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	sort.Strings(names)
+
+	// validated by validateArgs
+	extra, _ := parseForwardSignals(c.GlobalString("forward-signals"))
+	sigCh := make(chan os.Signal, 4)
+	signal.Notify(sigCh, append(forwardedSignals, extra...)...)
+	defer signal.Stop(sigCh)
+	stopDebug := watchDebugSignal(c)
+	defer stopDebug()
+
+	out := &prefixedOutput{w: os.Stdout}
+	exitCh := make(chan processExit, len(names))
+	var cmds []*exec.Cmd
+	signalAll := func(sig os.Signal) {
+		for _, cmd := range cmds {
+			// fails for processes that already exited
+			_ = cmd.Process.Signal(sig)
+		}
+	}
+	stopAll := func() {
+		for _, cmd := range cmds {
+			if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+				_ = cmd.Process.Kill()
+			}
+		}
+	}
+
+	commands := map[string]procfileCommand{}
+	for _, name := range names {
+		cmd, err := parseProcfileCommand(processes[name])
+		if err != nil {
+			return cli.NewExitError(errorPrefix(fmt.Errorf("invalid Procfile entry %s: %v", name, err)), RunCommandError)
+		}
+		commands[name] = cmd
+	}
+
+	for _, name := range names {
+		entry := commands[name]
+		cmd := exec.Command(entry.Path, append(entry.Args, asFlagArgs(c)...)...)
+		if len(entry.Env) > 0 {
+			cmd.Env = append(os.Environ(), entry.Env...)
+		}
+		w := out.writer(fmt.Sprintf("%-*s | ", width, name))
+		cmd.Stdout = w
+		cmd.Stderr = w
+
+		cleanup, err := startCommand(c, cmd)
+		if err != nil {
+			log.WithError(err).WithField("process", name).Error("failed to start process, stopping the others")
+			stopAll()
+			for range cmds {
+				<-exitCh
+			}
+			return err
+		}
+		defer cleanup()
+		log.WithField("process", name).WithField("pid", cmd.Process.Pid).Info("started process")
+		cmds = append(cmds, cmd)
+
+		go func() {
+			err := cmd.Wait()
+			w.flush()
+			exitCh <- processExit{name: name, err: err}
+		}()
+	}
+
+	var first *processExit
+	var shutdownCh <-chan time.Time
+	startShutdownTimer := func() {
+		if timeout := c.GlobalDuration("shutdown-timeout"); timeout > 0 && shutdownCh == nil {
+			shutdownCh = time.After(timeout)
+		}
+	}
+
+	for remaining := len(cmds); remaining > 0; {
+		select {
+		case sig := <-sigCh:
+			signalAll(sig)
+			if sig == syscall.SIGINT || sig == syscall.SIGTERM {
+				startShutdownTimer()
+			}
+		case <-shutdownCh:
+			log.WithField("timeout", c.GlobalDuration("shutdown-timeout").String()).Warn("processes did not stop within the shutdown timeout, killing them")
+			for _, cmd := range cmds {
+				_ = cmd.Process.Kill()
+			}
+		case exit := <-exitCh:
+			remaining--
+			entry := log.WithField("process", exit.name)
+			if exit.err != nil {
+				entry = entry.WithError(exit.err)
+			}
+			if first != nil {
+				entry.Info("process exited")
+				continue
+			}
+			first = &exit
+			entry.Info("process exited, stopping the others")
+			stopAll()
+			startShutdownTimer()
+		}
+	}
+	return withCommandExitCode(first.err)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+func pushCommand() cli.Command {
+	return cli.Command{
+		Name:      "push",
+		Usage:     "Create or update SSM parameters under a prefix from a dotenv file",
+		UsageText: "ssm-env push --prefix /app --from .env [--secure [--kms-key-id key]] [--overwrite] [--confirm | --dry-run]",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "prefix, p",
+				Usage: "Key prefix the parameters are written under",
+			},
+			cli.StringFlag{
+				Name:  "from",
+				Usage: "Path to the dotenv file to read the parameters from",
+			},
+			cli.BoolFlag{
+				Name:  "secure",
+				Usage: "Store parameters as SecureString instead of String",
+			},
+			cli.StringFlag{
+				Name:  "kms-key-id",
+				Usage: "KMS key used to encrypt SecureString parameters, defaults to the account's aws/ssm key",
+			},
+			cli.BoolFlag{
+				Name:  "overwrite",
+				Usage: "Allow updating parameters that already exist",
+			},
+			cli.StringSliceFlag{
+				Name:  "push-name-transform",
+				Usage: "Transform applied to env names to build the parameter key, applied in order - supports multiple use (lowercase|underscore-to-slash)",
+			},
+			cli.BoolFlag{
+				Name:  "confirm",
+				Usage: "Confirm writing to SSM, without it only the changes are printed",
+			},
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Print which parameters would be created, updated or left unchanged without writing to SSM",
+			},
+		},
+		Action: pushAction,
+	}
+}
+
+func pushAction(c *cli.Context) error {
+	if err := configureLogging(c); err != nil {
+		return cli.NewExitError(errorPrefix(err), ValidateArgsError)
+	}
+
+	if err := validatePushArgs(c); err != nil {
+		return cli.NewExitError(errorPrefix(err), ValidateArgsError)
+	}
+
+	content, err := ioutil.ReadFile(c.String("from"))
+	if err != nil {
+		return cli.NewExitError(errorPrefix(err), PushParametersError)
+	}
+	vars, err := parseDotenv(content)
+	if err != nil {
+		return cli.NewExitError(errorPrefix(fmt.Errorf("%s: %v", c.String("from"), err)), PushParametersError)
+	}
+
+	ctx := context.TODO()
+	svc, err := newSSMClient(ctx, c)
+	if err != nil {
+		return cli.NewExitError(errorPrefix(err), PushParametersError)
+	}
+	return push(ctx, c, svc, vars)
+}
+
+// pushClient is the part of the SSM API a push uses
+type pushClient interface {
+	parametersGetter
+	PutParameter(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error)
+}
+
+// push writes vars to SSM with --confirm, and otherwise only prints the
+// changes it would make.
+func push(ctx context.Context, c *cli.Context, svc pushClient, vars []envVar) error {
+	// without confirmation a push only shows what it would do
+	if c.Bool("dry-run") || !c.Bool("confirm") {
+		if err := diffPushParameters(ctx, c, svc, vars); err != nil {
+			return cli.NewExitError(errorPrefix(err), PushParametersError)
+		}
+		if !c.Bool("dry-run") {
+			return cli.NewExitError(errorPrefix(errors.New("refusing to modify SSM without --confirm, nothing was written")), PushParametersError)
+		}
+		return nil
+	}
+	if err := pushParameters(ctx, c, svc, vars); err != nil {
+		return cli.NewExitError(errorPrefix(err), PushParametersError)
+	}
+	return nil
+}
+
+func validatePushArgs(c *cli.Context) error {
+	if c.String("prefix") == "" {
+		return errors.New("prefix is required")
+	}
+	if c.String("from") == "" {
+		return errors.New("from is required")
+	}
+	if c.String("kms-key-id") != "" && !c.Bool("secure") {
+		return errors.New("kms-key-id can only be used together with secure")
+	}
+	for _, transform := range c.StringSlice("push-name-transform") {
+		if _, ok := pushNameTransforms[transform]; !ok {
+			return fmt.Errorf("invalid push-name-transform %q, expected lowercase or underscore-to-slash", transform)
+		}
+	}
+	return nil
+}
+
+func pushParameterType(c *cli.Context) types.ParameterType {
+	if c.Bool("secure") {
+		return types.ParameterTypeSecureString
+	}
+	return types.ParameterTypeString
+}
+
+// diffPushParameters compares the dotenv vars with the parameters currently
+// stored under their keys and prints the changes a push would make. Values
+// are never printed.
+func diffPushParameters(ctx context.Context, c *cli.Context, client parametersGetter, vars []envVar) error {
+	// the keys are looked up by name, as transforms like underscore-to-slash
+	// put them below the prefix at any depth
+	names := make([]string, 0, len(vars))
+	for _, v := range vars {
+		names = append(names, pushParameterName(c, v.Name))
+	}
+	existing, _, err := getParametersByName(ctx, client, names, true)
+	if err != nil {
+		return err
+	}
+	current := map[string]types.Parameter{}
+	for _, p := range existing {
+		current[*p.Name] = p
+	}
+
+	paramType := pushParameterType(c)
+	for _, v := range vars {
+		name := pushParameterName(c, v.Name)
+		p, ok := current[name]
+		switch {
+		case !ok:
+			fmt.Printf("create    %s\n", name)
+		case *p.Value != v.Value:
+			fmt.Printf("update    %s (value changed)\n", name)
+		case p.Type != paramType:
+			fmt.Printf("update    %s (type %s -> %s)\n", name, p.Type, paramType)
+		default:
+			fmt.Printf("unchanged %s\n", name)
+		}
+	}
+	return nil
+}
+
+func pushParameters(ctx context.Context, c *cli.Context, client pushClient, vars []envVar) error {
+	paramType := pushParameterType(c)
+	overwrite := c.Bool("overwrite")
+
+	for _, v := range vars {
+		name := pushParameterName(c, v.Name)
+		input := ssm.PutParameterInput{
+			Name:      &name,
+			Value:     &v.Value,
+			Type:      paramType,
+			Overwrite: &overwrite,
+		}
+		if keyID := c.String("kms-key-id"); keyID != "" {
+			input.KeyId = &keyID
+		}
+
+		if _, err := client.PutParameter(ctx, &input); err != nil {
+			var exists *types.ParameterAlreadyExists
+			if errors.As(err, &exists) {
+				return fmt.Errorf("parameter %s already exists, use --overwrite to update it", name)
+			}
+			return err
+		}
+		log.WithField("name", name).WithField("type", paramType).Info("pushed parameter")
+	}
+	return nil
+}
+
+var pushNameTransforms = map[string]func(string) string{
+	"lowercase": strings.ToLower,
+	"underscore-to-slash": func(name string) string {
+		return strings.ReplaceAll(name, "_", "/")
+	},
+}
+
+// pushParameterName maps an env name to its parameter key under the prefix,
+// applying the --push-name-transform steps in the order they were given.
+func pushParameterName(c *cli.Context, envName string) string {
+	for _, transform := range c.StringSlice("push-name-transform") {
+		envName = pushNameTransforms[transform](envName)
+	}
+	return strings.TrimSuffix(c.String("prefix"), "/") + "/" + envName
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// fakePushClient records the parameters written by a push, as if SSM held no
+// parameters yet.
+type fakePushClient struct {
+	puts []string
+}
+
+func (f *fakePushClient) GetParameters(ctx context.Context, params *ssm.GetParametersInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error) {
+	return &ssm.GetParametersOutput{InvalidParameters: params.Names}, nil
+}
+
+func (f *fakePushClient) PutParameter(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error) {
+	f.puts = append(f.puts, *params.Name)
+	return &ssm.PutParameterOutput{}, nil
+}
+
+func TestPushRequiresConfirm(t *testing.T) {
+	vars := []envVar{{Name: "DB_HOST", Value: "db.local"}, {Name: "DB_PORT", Value: "5432"}}
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+		puts    int
+	}{
+		{name: "no confirm", args: []string{"-p", "/app"}, wantErr: true, puts: 0},
+		{name: "dry run", args: []string{"-p", "/app", "--dry-run"}, puts: 0},
+		{name: "dry run with confirm", args: []string{"-p", "/app", "--dry-run", "--confirm"}, puts: 0},
+		{name: "confirm", args: []string{"-p", "/app", "--confirm"}, puts: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCommandContext(t, newTestContext(t), pushCommand(), tt.args...)
+			client := &fakePushClient{}
+			err := push(context.Background(), c, client, vars)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("push() error = %v, want error %t", err, tt.wantErr)
+			}
+			if len(client.puts) != tt.puts {
+				t.Errorf("PutParameter called for %v, want %d calls", client.puts, tt.puts)
+			}
+		})
+	}
+}
+
+func TestPushWritesTransformedNames(t *testing.T) {
+	c := newTestCommandContext(t, newTestContext(t), pushCommand(), "-p", "/app/", "--confirm", "--push-name-transform", "underscore-to-slash")
+	client := &fakePushClient{}
+	if err := push(context.Background(), c, client, []envVar{{Name: "DB_HOST", Value: "db.local"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.puts) != 1 || client.puts[0] != "/app/DB/HOST" {
+		t.Errorf("PutParameter called for %v, want [/app/DB/HOST]", client.puts)
+	}
+}
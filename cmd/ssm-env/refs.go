@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+const (
+	ssmRefScheme = "ssm://"
+	// maxRefDepth limits how many references are followed for one value
+	maxRefDepth = 8
+)
+
+// ssmRef points at another parameter, optionally in a different region
+type ssmRef struct {
+	Region string
+	Name   string
+}
+
+func (r ssmRef) String() string {
+	if r.Region == "" {
+		return ssmRefScheme + r.Name
+	}
+	return ssmRefScheme + r.Region + "/" + r.Name
+}
+
+// parseSSMRef parses a value of the form ssm:///path/to/param, resolved in
+// the region of the parameter holding it, or ssm://us-west-2//path/to/param,
+// resolved in the given region.
+func parseSSMRef(value string) (ssmRef, bool, error) {
+	if !strings.HasPrefix(value, ssmRefScheme) {
+		return ssmRef{}, false, nil
+	}
+	rest := strings.TrimPrefix(value, ssmRefScheme)
+	ref := ssmRef{Name: rest}
+	if i := strings.Index(rest, "/"); i > 0 {
+		ref = ssmRef{Region: rest[:i], Name: rest[i+1:]}
+	}
+	if !strings.HasPrefix(ref.Name, "/") || len(ref.Name) < 2 {
+		return ssmRef{}, false, fmt.Errorf("invalid reference %q, expected ssm:///path or ssm://region//path", value)
+	}
+	return ref, true, nil
+}
+
+// resolveSSMRefs replaces values that reference another parameter with the
+// value of that parameter, following chains of references up to maxRefDepth.
+// A value resolved through a SecureString counts as SecureString itself.
+func resolveSSMRefs(ctx context.Context, c *cli.Context, parameters []resolvedParameter) error {
+	resolved := map[ssmRef]types.Parameter{}
+	for i, p := range parameters {
+		ref, ok, err := parseSSMRef(*p.Value)
+		if err != nil {
+			return fmt.Errorf("parameter %s: %v", *p.Name, err)
+		}
+		if !ok {
+			continue
+		}
+
+		secure := p.Type == types.ParameterTypeSecureString
+		visited := map[ssmRef]bool{}
+		// references without a region are resolved in the region of the
+		// parameter holding them
+		region := p.Region
+		for ok {
+			if ref.Region != "" && ref.Region != region && !c.GlobalBool("ssm-refs-cross-region") {
+				return fmt.Errorf("parameter %s: resolving %s: cross-region references require --ssm-refs-cross-region", *p.Name, ref)
+			}
+			if ref.Region == "" {
+				ref.Region = region
+			}
+			if visited[ref] {
+				return fmt.Errorf("parameter %s: reference cycle at %s", *p.Name, ref)
+			}
+			if len(visited) == maxRefDepth {
+				return fmt.Errorf("parameter %s: more than %d nested references", *p.Name, maxRefDepth)
+			}
+			visited[ref] = true
+
+			target, err := fetchSSMRef(ctx, c, ref, resolved)
+			if err != nil {
+				return fmt.Errorf("parameter %s: resolving %s: %w", *p.Name, ref, err)
+			}
+			secure = secure || target.Type == types.ParameterTypeSecureString
+			log.WithField("name", *p.Name).WithField("reference", ref.String()).Debug("resolved ssm reference")
+			parameters[i].Value = target.Value
+			region = ref.Region
+
+			if ref, ok, err = parseSSMRef(*target.Value); err != nil {
+				return fmt.Errorf("parameter %s: %v", *p.Name, err)
+			}
+		}
+		if secure {
+			parameters[i].Type = types.ParameterTypeSecureString
+		}
+	}
+	return nil
+}
+
+// fetchSSMRef loads the referenced parameter, reusing earlier results as
+// several values may point at the same parameter.
+func fetchSSMRef(ctx context.Context, c *cli.Context, ref ssmRef, resolved map[ssmRef]types.Parameter) (types.Parameter, error) {
+	if p, ok := resolved[ref]; ok {
+		return p, nil
+	}
+	client, err := newRegionalSSMClient(ctx, c, ref.Region)
+	if err != nil {
+		return types.Parameter{}, err
+	}
+	out, err := client.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(ref.Name),
+		WithDecryption: aws.Bool(!c.GlobalBool("no-decryption")),
+	})
+	if err != nil {
+		return types.Parameter{}, err
+	}
+	resolved[ref] = *out.Parameter
+	return *out.Parameter, nil
+}
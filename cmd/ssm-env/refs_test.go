@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSSMRefsResolveInTheRegionOfTheirParameter(t *testing.T) {
+	useFakeSSM(t, &fakeSSM{parameters: map[string]string{
+		"/app/DB_HOST":    "ssm:///shared/db-host",
+		"/app/REGIONAL":   "ssm://eu-west-1//shared/pointer",
+		"/shared/db-host": "db.us-east-1",
+	}})
+	useRegionalFakeSSM(t, &fakeSSM{parameters: map[string]string{
+		"/app/DB_HOST":    "ssm:///shared/db-host",
+		"/shared/db-host": "db.eu-west-1",
+		"/shared/pointer": "ssm:///shared/db-host",
+		"/app/SAME":       "ssm://eu-west-1//shared/db-host",
+		"/app/OTHER":      "ssm://us-west-2//shared/db-host",
+	}}, "eu-west-1")
+
+	tests := []struct {
+		args   []string
+		values map[string]string
+		err    string
+	}{
+		{
+			args: []string{"-p", "/app"},
+			err:  "cross-region references require --ssm-refs-cross-region",
+		},
+		{
+			args:   []string{"-p", "/app", "--ssm-refs-cross-region"},
+			values: map[string]string{"DB_HOST": "db.us-east-1", "REGIONAL": "db.eu-west-1"},
+		},
+		{
+			args: []string{"-p", "eu-west-1:/app", "--include", "/app/DB_HOST", "--include", "/app/SAME"},
+			// the region of the parameter holding the reference
+			values: map[string]string{"DB_HOST": "db.eu-west-1", "SAME": "db.eu-west-1"},
+		},
+		{
+			args: []string{"-p", "eu-west-1:/app", "--include", "/app/OTHER"},
+			err:  "cross-region references require --ssm-refs-cross-region",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			c := newTestContext(t, append(tt.args, "--resolve-ssm-refs")...)
+			parameters, err := fetchParameters(context.Background(), c)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("fetchParameters() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			values := map[string]string{}
+			for _, p := range parameters {
+				values[p.EnvName] = *p.Value
+			}
+			for name, value := range tt.values {
+				if values[name] != value {
+					t.Errorf("%s = %q, want %q", name, values[name], value)
+				}
+			}
+		})
+	}
+}
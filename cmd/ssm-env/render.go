@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// renderSpec is a --render template and the file it is rendered to
+type renderSpec struct {
+	Template    string
+	Destination string
+}
+
+// templateData is what the --render templates are executed with
+type templateData struct {
+	Env map[string]string
+}
+
+func parseRenderSpecs(specs []string) ([]renderSpec, error) {
+	var parsed []renderSpec
+	for _, spec := range specs {
+		pair := strings.SplitN(spec, ":", 2)
+		if len(pair) != 2 || pair[0] == "" || pair[1] == "" {
+			return nil, fmt.Errorf("invalid render %q, expected template:destination", spec)
+		}
+		parsed = append(parsed, renderSpec{Template: pair[0], Destination: pair[1]})
+	}
+	return parsed, nil
+}
+
+// renderTemplates executes every --render template with the resolved
+// parameters as .Env and writes the results to their destinations, with the
+// file mode of the template. All templates are rendered before anything is
+// written, so a template that fails leaves all destinations untouched.
+func renderTemplates(c *cli.Context, parameters []resolvedParameter) error {
+	// validated by validateArgs
+	specs, _ := parseRenderSpecs(c.GlobalStringSlice("render"))
+	if len(specs) == 0 {
+		return nil
+	}
+
+	data := templateData{Env: map[string]string{}}
+	for _, v := range resolvedVars(parameters) {
+		data.Env[v.Name] = v.Value
+	}
+
+	rendered := make([][]byte, len(specs))
+	modes := make([]os.FileMode, len(specs))
+	for i, spec := range specs {
+		info, err := os.Stat(spec.Template)
+		if err != nil {
+			return err
+		}
+		content, err := ioutil.ReadFile(spec.Template)
+		if err != nil {
+			return err
+		}
+		tmpl, err := template.New(filepath.Base(spec.Template)).Option("missingkey=error").Parse(string(content))
+		if err != nil {
+			return fmt.Errorf("template %s: %v", spec.Template, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return fmt.Errorf("template %s: %v", spec.Template, err)
+		}
+		rendered[i] = buf.Bytes()
+		modes[i] = info.Mode().Perm()
+	}
+
+	for i, spec := range specs {
+		if err := writeFileAtomic(spec.Destination, rendered[i], modes[i]); err != nil {
+			return err
+		}
+		log.WithField("template", spec.Template).WithField("destination", spec.Destination).Debug("rendered template")
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// recentRestarts drops the restarts that happened before the restart window.
+func recentRestarts(restarts []time.Time, now time.Time, window time.Duration) []time.Time {
+	recent := restarts[:0]
+	for _, t := range restarts {
+		if now.Sub(t) < window {
+			recent = append(recent, t)
+		}
+	}
+	return recent
+}
+
+// restartDelay returns the backoff before the nth restart within the restart
+// window: --restart-backoff doubled for every previous restart, capped at
+// --restart-backoff-max.
+func restartDelay(c *cli.Context, n int) time.Duration {
+	delay := c.GlobalDuration("restart-backoff")
+	max := c.GlobalDuration("restart-backoff-max")
+	for i := 1; i < n && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// waitRestartBackoff waits for delay before the command is restarted. It
+// returns false if ssm-env was asked to shut down in the meantime. Other
+// signals are dropped as there is no command to forward them to.
+func waitRestartBackoff(delay time.Duration, sigCh <-chan os.Signal) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			return true
+		case sig := <-sigCh:
+			if sig == syscall.SIGINT || sig == syscall.SIGTERM {
+				return false
+			}
+		}
+	}
+}
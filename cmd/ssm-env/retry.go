@@ -0,0 +1,42 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// newRetryer returns the SDK's standard retryer, which retries throttling
+// and transient server errors, with --max-retries and a backoff starting at
+// --retry-base-delay.
+func newRetryer(c *cli.Context) func() aws.Retryer {
+	maxRetries := c.GlobalInt("max-retries")
+	baseDelay := c.GlobalDuration("retry-base-delay")
+	return func() aws.Retryer {
+		return retry.NewStandard(func(o *retry.StandardOptions) {
+			o.MaxAttempts = maxRetries + 1
+			o.Backoff = retry.BackoffDelayerFunc(func(attempt int, err error) (time.Duration, error) {
+				delay := backoffDelay(baseDelay, attempt)
+				log.WithError(err).WithField("attempt", attempt).WithField("delay", delay.String()).Debug("retrying AWS request")
+				return delay, nil
+			})
+		})
+	}
+}
+
+// backoffDelay returns a random delay of up to baseDelay doubled for every
+// previous attempt, capped at the SDK's maximum backoff.
+func backoffDelay(baseDelay time.Duration, attempt int) time.Duration {
+	ceiling := baseDelay
+	for i := 1; i < attempt && ceiling < retry.DefaultMaxBackoff; i++ {
+		ceiling *= 2
+	}
+	if ceiling > retry.DefaultMaxBackoff {
+		ceiling = retry.DefaultMaxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// runIDSource provides the randomness of the run ID
+var runIDSource io.Reader = rand.Reader
+
+// newRunID returns a random (version 4) UUID read from source.
+func newRunID(source io.Reader) (string, error) {
+	var b [16]byte
+	if _, err := io.ReadFull(source, b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// runIDHook adds the run ID to every log entry of ssm-env
+type runIDHook struct {
+	runID string
+}
+
+func (h runIDHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h runIDHook) Fire(entry *log.Entry) error {
+	entry.Data["run_id"] = h.runID
+	return nil
+}
+
+// injectRunID generates the run ID, sets it as the --run-id-var env var for
+// the command and attaches it to the logs of ssm-env.
+func injectRunID(c *cli.Context) error {
+	name := c.GlobalString("run-id-var")
+	if name == "" {
+		return nil
+	}
+	runID, err := newRunID(runIDSource)
+	if err != nil {
+		return fmt.Errorf("unable to generate run id: %v", err)
+	}
+	if err := os.Setenv(name, runID); err != nil {
+		return err
+	}
+	log.AddHook(runIDHook{runID: runID})
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+func newSecretsManagerClient(ctx context.Context, c *cli.Context) (*secretsmanager.Client, error) {
+	cfg, err := loadAWSConfig(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return secretsmanager.NewFromConfig(cfg, func(o *secretsmanager.Options) {
+		// local stacks like LocalStack serve all services on one endpoint
+		if endpoint := c.GlobalString("ssm-endpoint-url"); endpoint != "" {
+			o.EndpointResolver = secretsmanager.EndpointResolverFromURL(endpoint)
+		}
+	}), nil
+}
+
+// fetchManagedSecrets loads the Secrets Manager secrets whose names start with
+// one of the --secrets-prefix prefixes. Secrets are named like parameters,
+// by the base of their name or with --long-env-name by their name below the
+// prefix. With --secrets-json-expand every top-level key of a secret holding
+// a JSON object becomes its own env var instead.
+func fetchManagedSecrets(ctx context.Context, c *cli.Context) ([]resolvedParameter, error) {
+	secretsPrefixes := c.GlobalStringSlice("secrets-prefix")
+	if len(secretsPrefixes) == 0 {
+		return nil, nil
+	}
+	svc, err := newSecretsManagerClient(ctx, c)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load SDK config, %v", err)
+	}
+
+	var resolved []resolvedParameter
+	for _, prefix := range secretsPrefixes {
+		names, err := listSecrets(ctx, svc, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list secrets %s: %v", prefix, err)
+		}
+		for _, name := range names {
+			result, err := svc.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: &name})
+			if err != nil {
+				return nil, fmt.Errorf("unable to read secret %s: %v", name, err)
+			}
+			if result.SecretString == nil {
+				log.WithField("secret", name).Warn("skipping binary secret")
+				continue
+			}
+			resolved = append(resolved, secretParameters(c, prefix, name, *result.SecretString)...)
+		}
+	}
+	return resolved, nil
+}
+
+// listSecrets returns the names of the secrets starting with prefix, sorted
+// so the order of the env vars is stable.
+func listSecrets(ctx context.Context, svc *secretsmanager.Client, prefix string) ([]string, error) {
+	input := secretsmanager.ListSecretsInput{
+		Filters: []smtypes.Filter{{Key: smtypes.FilterNameStringTypeName, Values: []string{prefix}}},
+	}
+	var names []string
+	for {
+		result, err := svc.ListSecrets(ctx, &input)
+		if err != nil {
+			return nil, err
+		}
+		for _, secret := range result.SecretList {
+			// the name filter ignores case
+			if strings.HasPrefix(*secret.Name, prefix) {
+				names = append(names, *secret.Name)
+			}
+		}
+		if result.NextToken == nil {
+			break
+		}
+		input.NextToken = result.NextToken
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func secretParameters(c *cli.Context, prefix, name, value string) []resolvedParameter {
+	secret := func(envName, value string) resolvedParameter {
+		return resolvedParameter{
+			Parameter: types.Parameter{
+				Name:  aws.String(sourceSecretsManager + ":" + name),
+				Value: aws.String(value),
+				Type:  types.ParameterTypeSecureString,
+			},
+			Source:  sourceSecretsManager,
+			Prefix:  sourceSecretsManager + ":" + prefix,
+			EnvName: envName,
+		}
+	}
+
+	var object map[string]json.RawMessage
+	if !c.GlobalBool("secrets-json-expand") || json.Unmarshal([]byte(value), &object) != nil {
+		return []resolvedParameter{secret(envName(name, normalizePrefix(prefix), c.GlobalBool("long-env-name")), value)}
+	}
+
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var resolved []resolvedParameter
+	for _, key := range keys {
+		// strings are used as is, other values keep their JSON encoding
+		var s string
+		if json.Unmarshal(object[key], &s) != nil {
+			s = string(object[key])
+		}
+		resolved = append(resolved, secret(key, s))
+	}
+	return resolved
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// forwardedSignals are relayed to the command unless --exec is used
+var forwardedSignals = []os.Signal{syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGABRT, syscall.SIGTERM}
+
+// unforwardableSignals can't be caught, or are about ssm-env's own children
+var unforwardableSignals = map[string]bool{"KILL": true, "STOP": true, "CHLD": true}
+
+// parseForwardSignals parses the comma separated --forward-signals names.
+func parseForwardSignals(names string) ([]os.Signal, error) {
+	var signals []os.Signal
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if unforwardableSignals[strings.TrimPrefix(strings.ToUpper(name), "SIG")] {
+			return nil, fmt.Errorf("signal %s can't be forwarded", name)
+		}
+		sig, err := parseSignal(name)
+		if err != nil {
+			return nil, err
+		}
+		signals = append(signals, sig)
+	}
+	return signals, nil
+}
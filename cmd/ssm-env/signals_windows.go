@@ -0,0 +1,18 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// defaultDebugSignal is empty as windows has no spare signal to use
+const defaultDebugSignal = ""
+
+// signalsByName maps the signal names accepted by flags to their signals
+var signalsByName = map[string]os.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"ABRT": syscall.SIGABRT,
+	"TERM": syscall.SIGTERM,
+}
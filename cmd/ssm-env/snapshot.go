@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// snapshot records the versions of the fetched SSM parameters and a hash of
+// the resolved values of all parameters.
+type snapshot struct {
+	Hash       string           `json:"hash,omitempty"`
+	Parameters map[string]int64 `json:"parameters"`
+}
+
+func takeSnapshot(parameters []resolvedParameter) snapshot {
+	sum := sha256.Sum256([]byte(formatDotenv(resolvedVars(parameters))))
+	s := snapshot{Hash: hex.EncodeToString(sum[:]), Parameters: map[string]int64{}}
+	for _, p := range parameters {
+		if p.Source == sourceSSM {
+			s.Parameters[*p.Name] = p.Version
+		}
+	}
+	return s
+}
+
+func readSnapshot(file string) (snapshot, error) {
+	var s snapshot
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(content, &s); err != nil {
+		return s, fmt.Errorf("malformed snapshot %s: %v", file, err)
+	}
+	return s, nil
+}
+
+func writeSnapshot(file string, s snapshot) error {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(content, '\n'), 0644)
+}
+
+// drift returns a description of every parameter whose version differs from
+// the pinned snapshot, sorted by parameter name.
+func drift(pinned, current snapshot) []string {
+	var drifted []string
+	for name, version := range pinned.Parameters {
+		currentVersion, ok := current.Parameters[name]
+		switch {
+		case !ok:
+			drifted = append(drifted, fmt.Sprintf("%s: pinned version %d, now missing", name, version))
+		case currentVersion != version:
+			drifted = append(drifted, fmt.Sprintf("%s: pinned version %d, now version %d", name, version, currentVersion))
+		}
+	}
+	for name, version := range current.Parameters {
+		if _, ok := pinned.Parameters[name]; !ok {
+			drifted = append(drifted, fmt.Sprintf("%s: not pinned, now version %d", name, version))
+		}
+	}
+	sort.Strings(drifted)
+	return drifted
+}
+
+// checkSnapshots compares the fetched parameters with --pin-snapshot and
+// writes them to --write-snapshot.
+func checkSnapshots(c *cli.Context, parameters []resolvedParameter) error {
+	current := takeSnapshot(parameters)
+
+	if file := c.GlobalString("pin-snapshot"); file != "" {
+		pinned, err := readSnapshot(file)
+		if err != nil {
+			return err
+		}
+		drifted := drift(pinned, current)
+		for _, d := range drifted {
+			log.WithField("snapshot", file).Warn("parameter drifted: " + d)
+		}
+		if len(drifted) > 0 && c.GlobalBool("fail-on-drift") {
+			return fmt.Errorf("%d parameters drifted from snapshot %s", len(drifted), file)
+		}
+	}
+
+	if file := c.GlobalString("write-snapshot"); file != "" {
+		if err := writeSnapshot(file, current); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changedSince reports whether the resolved values differ from the ones hashed
+// in the snapshot file --since. A missing file counts as changed. With
+// --update-since the file is replaced with the current snapshot afterwards.
+func changedSince(c *cli.Context, parameters []resolvedParameter) (bool, error) {
+	file := c.GlobalString("since")
+	current := takeSnapshot(parameters)
+
+	changed := true
+	previous, err := readSnapshot(file)
+	switch {
+	case err == nil:
+		changed = previous.Hash != current.Hash
+	case !os.IsNotExist(err):
+		return false, err
+	}
+
+	if c.GlobalBool("update-since") {
+		if err := writeSnapshot(file, current); err != nil {
+			return false, err
+		}
+	}
+	return changed, nil
+}
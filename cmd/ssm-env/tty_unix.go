@@ -0,0 +1,61 @@
+//go:build !windows
+
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/creack/pty"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/term"
+)
+
+// startTTY starts cmd attached to a new pseudo-terminal and proxies it to our
+// own stdio. The returned cleanup func restores the terminal and must only be
+// called after the command has exited.
+func startTTY(cmd *exec.Cmd) (func(), error) {
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	// keep the pty window size in sync with ours
+	winchCh := make(chan os.Signal, 1)
+	signal.Notify(winchCh, syscall.SIGWINCH)
+	go func() {
+		for range winchCh {
+			if err := pty.InheritSize(os.Stdin, ptmx); err != nil {
+				log.WithError(err).Debug("unable to resize pty")
+			}
+		}
+	}()
+	winchCh <- syscall.SIGWINCH
+
+	var oldState *term.State
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		if oldState, err = term.MakeRaw(int(os.Stdin.Fd())); err != nil {
+			log.WithError(err).Warn("unable to put terminal into raw mode")
+		}
+	}
+
+	go func() { _, _ = io.Copy(ptmx, os.Stdin) }()
+	outputDone := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(os.Stdout, ptmx)
+		close(outputDone)
+	}()
+
+	return func() {
+		signal.Stop(winchCh)
+		close(winchCh)
+		<-outputDone
+		_ = ptmx.Close()
+		if oldState != nil {
+			_ = term.Restore(int(os.Stdin.Fd()), oldState)
+		}
+	}, nil
+}
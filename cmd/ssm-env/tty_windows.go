@@ -0,0 +1,10 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func startTTY(cmd *exec.Cmd) (func(), error) {
+	return nil, errors.New("--tty is not supported on windows")
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// namedValidators are the shortcuts accepted by --validate instead of a regex
+var namedValidators = map[string]func(string) bool{
+	"int": func(value string) bool {
+		_, err := strconv.ParseInt(value, 10, 64)
+		return err == nil
+	},
+	"bool": func(value string) bool {
+		_, err := strconv.ParseBool(value)
+		return err == nil
+	},
+	"url": func(value string) bool {
+		u, err := url.Parse(value)
+		return err == nil && u.Scheme != "" && u.Host != ""
+	},
+	"nonempty": func(value string) bool {
+		return value != ""
+	},
+}
+
+type valueValidator struct {
+	Name    string
+	Pattern string
+	check   func(string) bool
+}
+
+// parseValidators parses the KEY=pattern arguments of --validate. A pattern
+// is either one of the named validators or a regex that has to match the
+// whole value.
+func parseValidators(c *cli.Context) ([]valueValidator, error) {
+	var validators []valueValidator
+	for _, arg := range c.GlobalStringSlice("validate") {
+		pair := strings.SplitN(arg, "=", 2)
+		if len(pair) != 2 || pair[0] == "" || pair[1] == "" {
+			return nil, fmt.Errorf("invalid validate %q, expected KEY=regex or KEY=int|bool|url|nonempty", arg)
+		}
+
+		v := valueValidator{Name: pair[0], Pattern: pair[1], check: namedValidators[pair[1]]}
+		if v.check == nil {
+			re, err := regexp.Compile("^(?:" + pair[1] + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid validate regex for %s: %v", pair[0], err)
+			}
+			v.check = re.MatchString
+		}
+		validators = append(validators, v)
+	}
+	return validators, nil
+}
+
+// validateValues checks the resolved environment against --validate.
+func validateValues(c *cli.Context) error {
+	validators, err := parseValidators(c)
+	if err != nil {
+		return err
+	}
+	for _, v := range validators {
+		value, ok := os.LookupEnv(v.Name)
+		if !ok {
+			return fmt.Errorf("%s is not set, expected it to match %s", v.Name, v.Pattern)
+		}
+		if !v.check(value) {
+			return fmt.Errorf("%s does not match %s", v.Name, v.Pattern)
+		}
+	}
+	return nil
+}
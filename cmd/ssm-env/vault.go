@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/urfave/cli"
+)
+
+// fetchVaultSecrets reads the KV secrets given with --vault-path from the
+// Vault server at $VAULT_ADDR, authenticating with $VAULT_TOKEN. Every key of
+// a secret becomes an env var.
+func fetchVaultSecrets(ctx context.Context, c *cli.Context) ([]resolvedParameter, error) {
+	var resolved []resolvedParameter
+	for _, secretPath := range c.GlobalStringSlice("vault-path") {
+		data, err := readVaultSecret(ctx, secretPath, c.GlobalInt("vault-kv-version"))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read vault secret %s: %v", secretPath, err)
+		}
+
+		keys := make([]string, 0, len(data))
+		for key := range data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			resolved = append(resolved, resolvedParameter{
+				Parameter: types.Parameter{
+					Name:  aws.String("vault:" + secretPath + "/" + key),
+					Value: aws.String(data[key]),
+					Type:  types.ParameterTypeSecureString,
+				},
+				Source:  sourceVault,
+				Prefix:  "vault:" + secretPath,
+				EnvName: key,
+			})
+		}
+	}
+	return resolved, nil
+}
+
+func readVaultSecret(ctx context.Context, secretPath string, kvVersion int) (map[string]string, error) {
+	addr, token := os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return nil, errors.New("VAULT_ADDR and VAULT_TOKEN must be set")
+	}
+
+	apiPath := strings.Trim(secretPath, "/")
+	if kvVersion == 2 {
+		// KV v2 serves secrets under <mount>/data/<path>
+		parts := strings.SplitN(apiPath, "/", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("expected <mount>/<path>")
+		}
+		apiPath = parts[0] + "/data/" + parts[1]
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(addr, "/")+"/v1/"+apiPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault responded with %s", resp.Status)
+	}
+
+	var body struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	raw := body.Data
+	if kvVersion == 2 {
+		var v2 struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(raw, &v2); err != nil {
+			return nil, err
+		}
+		raw = v2.Data
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	data := make(map[string]string, len(fields))
+	for key, value := range fields {
+		if str, ok := value.(string); ok {
+			data[key] = str
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		data[key] = string(encoded)
+	}
+	return data, nil
+}
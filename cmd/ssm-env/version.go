@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+
+	"github.com/urfave/cli"
+)
+
+// set at build time with -ldflags "-X main.CommitString=... -X main.BuildDateString=..."
+var CommitString string
+var BuildDateString string
+
+// versionInfo is the build metadata printed by --version
+type versionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+func buildVersionInfo() versionInfo {
+	unknown := func(s string) string {
+		if s == "" {
+			return "unknown"
+		}
+		return s
+	}
+	return versionInfo{
+		Version:   version(),
+		Commit:    unknown(CommitString),
+		BuildDate: unknown(BuildDateString),
+		GoVersion: runtime.Version(),
+	}
+}
+
+// version returns VersionString, or "dev" for builds without a version, so
+// --version is available in every build.
+func version() string {
+	if VersionString == "" {
+		return "dev"
+	}
+	return VersionString
+}
+
+// printVersion prints the build metadata, as JSON with --json. The first line
+// of the plain output is the same as the cli package prints, for scripts that
+// parse it.
+func printVersion(c *cli.Context) {
+	info := buildVersionInfo()
+	if c.GlobalBool("json") {
+		encoded, _ := json.Marshal(info)
+		fmt.Fprintln(c.App.Writer, string(encoded))
+		return
+	}
+	fmt.Fprintf(c.App.Writer, "%s version %s\n", c.App.Name, c.App.Version)
+	fmt.Fprintf(c.App.Writer, "commit:     %s\n", info.Commit)
+	fmt.Fprintf(c.App.Writer, "build date: %s\n", info.BuildDate)
+	fmt.Fprintf(c.App.Writer, "go version: %s\n", info.GoVersion)
+}